@@ -0,0 +1,45 @@
+package config
+
+// Defaults used for every field missing from the configuration. Fields that
+// are present keep their value, so an explicit 0 is reported by Validate
+// instead of being replaced.
+const (
+	DefaultServerRefreshRate     = 60
+	DefaultPort                  = 3001
+	DefaultCronJob               = "0 0 * * *"
+	DefaultRetentionDays         = 7
+	DefaultHostRoot              = "/"
+	DefaultProcRoot              = "/proc"
+	DefaultProcessCount          = 10
+	DefaultProcessRetentionHours = 24
+	DefaultContainerRefreshRate  = 60
+	DefaultDockerSocket          = "/var/run/docker.sock"
+	DefaultContainerBackend      = "docker"
+	DefaultCgroupRoot            = "/sys/fs/cgroup"
+	DefaultFilesystemRefreshRate = 600
+	DefaultDiskUsageRefreshRate  = 3600
+)
+
+// DefaultExcludeFsTypes are the filesystems skipped by the mountpoint
+// discovery: memory-backed and container layers
+var DefaultExcludeFsTypes = []string{"tmpfs", "devtmpfs", "overlay", "squashfs"}
+
+func DefaultConfig() *Config {
+	cfg := &Config{}
+	cfg.Server.RefreshRate = DefaultServerRefreshRate
+	cfg.Server.Port = DefaultPort
+	cfg.Server.CronJob = DefaultCronJob
+	cfg.Server.RetentionDays = DefaultRetentionDays
+	cfg.Server.HostRoot = DefaultHostRoot
+	cfg.Server.ProcRoot = DefaultProcRoot
+	cfg.Server.Disk.ExcludeFsTypes = append([]string(nil), DefaultExcludeFsTypes...)
+	cfg.Server.Processes.Count = DefaultProcessCount
+	cfg.Server.Processes.RetentionHours = DefaultProcessRetentionHours
+	cfg.Containers.RefreshRate = DefaultContainerRefreshRate
+	cfg.Containers.DockerSocket = DefaultDockerSocket
+	cfg.Containers.Backend = DefaultContainerBackend
+	cfg.Containers.CgroupRoot = DefaultCgroupRoot
+	cfg.Containers.Filesystem.RefreshRate = DefaultFilesystemRefreshRate
+	cfg.Containers.DiskUsage.RefreshRate = DefaultDiskUsageRefreshRate
+	return cfg
+}
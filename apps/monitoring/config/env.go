@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// applyEnvOverrides sets every field that has a matching environment
+// variable. Names are derived from the JSON path: server.refreshRate is
+// METRICS_SERVER_REFRESH_RATE and lists are comma separated.
+func applyEnvOverrides(cfg *Config) ValidationErrors {
+	var errs ValidationErrors
+	overrideFields("", reflect.ValueOf(cfg).Elem(), &errs)
+	return errs
+}
+
+func overrideFields(path string, v reflect.Value, errs *ValidationErrors) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if path != "" {
+			name = path + "." + name
+		}
+
+		value := v.Field(i)
+		if value.Kind() == reflect.Struct {
+			overrideFields(name, value, errs)
+			continue
+		}
+
+		envName := EnvName(name)
+		raw, ok := os.LookupEnv(envName)
+		if !ok {
+			continue
+		}
+
+		switch value.Kind() {
+		case reflect.String:
+			value.SetString(raw)
+		case reflect.Int:
+			n, err := strconv.Atoi(strings.TrimSpace(raw))
+			if err != nil {
+				*errs = append(*errs, FieldError{Path: name, Message: fmt.Sprintf("%s must be an integer, got %q", envName, raw)})
+				continue
+			}
+			value.SetInt(int64(n))
+		case reflect.Slice:
+			var items []string
+			for _, item := range strings.Split(raw, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			value.Set(reflect.ValueOf(items))
+		}
+	}
+}
+
+// EnvName returns the environment variable overriding a config field
+func EnvName(path string) string {
+	var b strings.Builder
+	b.WriteString("METRICS")
+	for _, part := range strings.Split(path, ".") {
+		b.WriteByte('_')
+		for i, r := range part {
+			if unicode.IsUpper(r) && i > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"server.port":                      "METRICS_SERVER_PORT",
+		"server.refreshRate":               "METRICS_SERVER_REFRESH_RATE",
+		"server.thresholds.cpuPressure":    "METRICS_SERVER_THRESHOLDS_CPU_PRESSURE",
+		"containers.services.include":      "METRICS_CONTAINERS_SERVICES_INCLUDE",
+		"containers.diskUsage.refreshRate": "METRICS_CONTAINERS_DISK_USAGE_REFRESH_RATE",
+	}
+	for path, want := range tests {
+		if got := EnvName(path); got != want {
+			t.Errorf("EnvName(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	t.Setenv("METRICS_SERVER_PORT", " 4500 ")
+	t.Setenv("METRICS_SERVER_URL_CALLBACK", "http://dokploy:3000/api/alerts")
+	t.Setenv("METRICS_SERVER_THRESHOLDS_CPU", "80")
+	t.Setenv("METRICS_CONTAINERS_SERVICES_INCLUDE", "shop, blog_*,,regex:^api")
+
+	cfg := DefaultConfig()
+	if errs := applyEnvOverrides(cfg); len(errs) > 0 {
+		t.Fatalf("applyEnvOverrides: %v", errs)
+	}
+
+	if cfg.Server.Port != 4500 || cfg.Server.UrlCallback != "http://dokploy:3000/api/alerts" || cfg.Server.Thresholds.CPU != 80 {
+		t.Errorf("got port %d, urlCallback %q and cpu threshold %d", cfg.Server.Port, cfg.Server.UrlCallback, cfg.Server.Thresholds.CPU)
+	}
+	if want := []string{"shop", "blog_*", "regex:^api"}; !reflect.DeepEqual(cfg.Containers.Services.Include, want) {
+		t.Errorf("got include %q, want %q", cfg.Containers.Services.Include, want)
+	}
+	// Fields without a variable keep their value
+	if cfg.Server.RefreshRate != DefaultServerRefreshRate {
+		t.Errorf("got refreshRate %d, want the default", cfg.Server.RefreshRate)
+	}
+}
+
+func TestApplyEnvOverridesInvalidInteger(t *testing.T) {
+	t.Setenv("METRICS_CONTAINERS_REFRESH_RATE", "30s")
+
+	errs := applyEnvOverrides(DefaultConfig())
+	if len(errs) != 1 || errs[0].Path != "containers.refreshRate" {
+		t.Errorf("got %v, want an error for containers.refreshRate", errs)
+	}
+}
@@ -1,10 +1,17 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
@@ -16,42 +23,194 @@ type Config struct {
 		UrlCallback   string `json:"urlCallback"`
 		CronJob       string `json:"cronJob"`
 		RetentionDays int    `json:"retentionDays"`
+		HostRoot      string `json:"hostRoot"`
+		ProcRoot      string `json:"procRoot"`
 		Thresholds    struct {
 			CPU    int `json:"cpu"`
 			Memory int `json:"memory"`
+			Disk   int `json:"disk"`
+			Inodes int `json:"inodes"`
+			Swap   int `json:"swap"`
+
+			// Pressure thresholds apply to the "some" avg60 of the host PSI
+			CPUPressure    int `json:"cpuPressure"`
+			MemoryPressure int `json:"memoryPressure"`
+			IOPressure     int `json:"ioPressure"`
 		} `json:"thresholds"`
+		Network struct {
+			Include []string `json:"include"`
+			Exclude []string `json:"exclude"`
+		} `json:"network"`
+		Disk struct {
+			Mountpoints    []string `json:"mountpoints"`
+			ExcludeFsTypes []string `json:"excludeFsTypes"`
+		} `json:"disk"`
+		Processes struct {
+			Count          int `json:"count"`
+			RetentionHours int `json:"retentionHours"`
+		} `json:"processes"`
 	} `json:"server"`
 	Containers struct {
-		RefreshRate int `json:"refreshRate"`
-		Services    struct {
+		RefreshRate  int    `json:"refreshRate"`
+		DockerSocket string `json:"dockerSocket"`
+		Backend      string `json:"backend"`
+		CgroupRoot   string `json:"cgroupRoot"`
+		Services     struct {
 			Include []string `json:"include"`
 			Exclude []string `json:"exclude"`
 		} `json:"services"`
+		Filesystem struct {
+			// Seconds between two samples of the container filesystem size, 0 disables it
+			RefreshRate int `json:"refreshRate"`
+		} `json:"filesystem"`
+		DiskUsage struct {
+			// Seconds between two `docker system df` collections, 0 disables it
+			RefreshRate int `json:"refreshRate"`
+		} `json:"diskUsage"`
 	} `json:"containers"`
 }
 
+// HostPath returns where a path of the host filesystem, such as /proc or a
+// mountpoint, is visible from the agent: under server.hostRoot when the
+// agent runs in a container with the host filesystem mounted there
+func (c *Config) HostPath(path string) string {
+	return filepath.Join(c.Server.HostRoot, path)
+}
+
+// ProcessRetention is how long the process snapshots are kept
+func (c *Config) ProcessRetention() time.Duration {
+	return time.Duration(c.Server.Processes.RetentionHours) * time.Hour
+}
+
 var (
 	config     *Config
-	configOnce sync.Once
+	configMu   sync.RWMutex
+	configPath string
 )
 
+// SetConfigPath sets the file passed with --config. It takes precedence over
+// the METRICS_CONFIG_FILE environment variable.
+func SetConfigPath(path string) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	configPath = path
+}
+
+// ConfigPath returns the file the configuration is read from, or "" when it
+// comes from the METRICS_CONFIG environment variable
+func ConfigPath() string {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	if configPath != "" {
+		return configPath
+	}
+	return os.Getenv("METRICS_CONFIG_FILE")
+}
+
 func GetMetricsConfig() *Config {
-	configOnce.Do(func() {
-		configJSON := os.Getenv("METRICS_CONFIG")
-		if configJSON == "" {
-			log.Fatal("METRICS_CONFIG environment variable is required")
-		}
+	configMu.RLock()
+	cfg := config
+	configMu.RUnlock()
+	if cfg != nil {
+		return cfg
+	}
+
+	loaded, err := LoadMetricsConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+	if config == nil {
+		config = loaded
+	}
+	return config
+}
 
-		config = &Config{}
-		if err := json.Unmarshal([]byte(configJSON), config); err != nil {
-			log.Fatalf("Error parsing METRICS_CONFIG: %v", err)
+// LoadMetricsConfig reads the configuration without applying it: defaults
+// first, then the config file or METRICS_CONFIG, then the per-field
+// environment overrides and finally the settings changed through the API.
+// Every validation problem is reported at once.
+func LoadMetricsConfig() (*Config, error) {
+	return LoadMetricsConfigWith(RuntimeOverrides())
+}
+
+// LoadMetricsConfigWith is LoadMetricsConfig with the given runtime settings
+// instead of the active ones, used to validate a change before storing it
+func LoadMetricsConfigWith(overrides *RuntimeSettings) (*Config, error) {
+	cfg := DefaultConfig()
+
+	if path := ConfigPath(); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading config file %s: %v", path, err)
+		}
+		if err := decodeConfig(path, content, cfg); err != nil {
+			return nil, fmt.Errorf("error parsing config file %s: %v", path, err)
 		}
+	} else if configJSON := os.Getenv("METRICS_CONFIG"); configJSON != "" {
+		if err := decodeConfig("", []byte(configJSON), cfg); err != nil {
+			return nil, fmt.Errorf("error parsing METRICS_CONFIG: %v", err)
+		}
+	}
+
+	errs := applyEnvOverrides(cfg)
+	for _, warning := range relaxLegacyFields(cfg) {
+		log.Printf("Warning: %v", warning)
+	}
+	overrides.apply(cfg)
+	errs = append(errs, Validate(cfg)...)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return cfg, nil
+}
 
-		// Validate required fields
-		if config.Server.Token == "" || config.Server.UrlCallback == "" {
-			log.Fatal("token and urlCallback are required in the configuration")
+// decodeConfig unmarshals JSON or YAML depending on the file extension, and
+// JSON without one. YAML is converted to JSON first so the json tags stay
+// the only field names.
+func decodeConfig(path string, content []byte, cfg *Config) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var document interface{}
+		if err := yaml.Unmarshal(content, &document); err != nil {
+			return err
 		}
-	})
+		converted, err := json.Marshal(document)
+		if err != nil {
+			return err
+		}
+		content = converted
+	}
 
-	return config
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(cfg)
+}
+
+// ReloadMetricsConfig reads the configuration again and swaps it in. The
+// previous configuration is kept when the new one is invalid.
+func ReloadMetricsConfig() (previous, current *Config, err error) {
+	loaded, err := LoadMetricsConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	configMu.Lock()
+	previous = config
+	config = loaded
+	configMu.Unlock()
+
+	return previous, loaded, nil
+}
+
+// SetMetricsConfig swaps in an already validated configuration
+func SetMetricsConfig(cfg *Config) (previous *Config) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	previous = config
+	config = cfg
+	return previous
 }
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Diff lists the fields that differ between two configurations as
+// "path: old -> new" using the JSON field names. The token is never printed.
+func Diff(previous, current *Config) []string {
+	var changes []string
+	diffValues("", reflect.ValueOf(*previous), reflect.ValueOf(*current), &changes)
+	return changes
+}
+
+func diffValues(path string, a, b reflect.Value, changes *[]string) {
+	if a.Kind() == reflect.Struct {
+		for i := 0; i < a.NumField(); i++ {
+			field := a.Type().Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "" {
+				name = field.Name
+			}
+			if path != "" {
+				name = path + "." + name
+			}
+			diffValues(name, a.Field(i), b.Field(i), changes)
+		}
+		return
+	}
+
+	if reflect.DeepEqual(a.Interface(), b.Interface()) {
+		return
+	}
+
+	if strings.HasSuffix(path, ".token") {
+		*changes = append(*changes, path+": changed")
+		return
+	}
+	*changes = append(*changes, fmt.Sprintf("%s: %v -> %v", path, a.Interface(), b.Interface()))
+}
+
+// WatchConfigFile polls the configuration file and calls onChange when its
+// modification time or size changes. Polling keeps working for bind-mounted
+// files that are replaced instead of written in place.
+func WatchConfigFile(path string, interval time.Duration, onChange func(), stop <-chan struct{}) {
+	lastMod, lastSize := fileVersion(path)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			mod, size := fileVersion(path)
+			if mod.IsZero() || (mod.Equal(lastMod) && size == lastSize) {
+				continue
+			}
+			lastMod, lastSize = mod, size
+			log.Printf("Config file %s changed", path)
+			onChange()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func fileVersion(path string) (time.Time, int64) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, 0
+	}
+	return info.ModTime(), info.Size()
+}
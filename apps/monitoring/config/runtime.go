@@ -0,0 +1,131 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+)
+
+// RuntimeSettings are the fields that can be changed through the API while
+// the agent runs. Nil fields keep the value from the file or environment.
+type RuntimeSettings struct {
+	Server struct {
+		RefreshRate *int `json:"refreshRate,omitempty"`
+		Thresholds  struct {
+			CPU    *int `json:"cpu,omitempty"`
+			Memory *int `json:"memory,omitempty"`
+			Disk   *int `json:"disk,omitempty"`
+			Inodes *int `json:"inodes,omitempty"`
+			Swap   *int `json:"swap,omitempty"`
+
+			CPUPressure    *int `json:"cpuPressure,omitempty"`
+			MemoryPressure *int `json:"memoryPressure,omitempty"`
+			IOPressure     *int `json:"ioPressure,omitempty"`
+		} `json:"thresholds"`
+	} `json:"server"`
+	Containers struct {
+		RefreshRate *int `json:"refreshRate,omitempty"`
+		Services    struct {
+			Include *[]string `json:"include,omitempty"`
+			Exclude *[]string `json:"exclude,omitempty"`
+		} `json:"services"`
+	} `json:"containers"`
+}
+
+var (
+	runtimeOverrides   = &RuntimeSettings{}
+	runtimeOverridesMu sync.RWMutex
+)
+
+// RuntimeOverrides returns a copy of the active runtime settings
+func RuntimeOverrides() *RuntimeSettings {
+	runtimeOverridesMu.RLock()
+	defer runtimeOverridesMu.RUnlock()
+	return runtimeOverrides.Clone()
+}
+
+func SetRuntimeOverrides(settings *RuntimeSettings) {
+	runtimeOverridesMu.Lock()
+	defer runtimeOverridesMu.Unlock()
+	runtimeOverrides = settings.Clone()
+}
+
+func (s *RuntimeSettings) Clone() *RuntimeSettings {
+	clone := &RuntimeSettings{}
+	if content, err := json.Marshal(s); err == nil {
+		json.Unmarshal(content, clone)
+	}
+	return clone
+}
+
+// Merge applies a partial update on top of the settings. Objects are merged,
+// lists are replaced and null clears an override. Unknown fields, including
+// the ones that cannot be changed at runtime, are rejected.
+func (s *RuntimeSettings) Merge(patch []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(patch))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(s)
+}
+
+func (s *RuntimeSettings) apply(cfg *Config) {
+	if s == nil {
+		return
+	}
+	if s.Server.RefreshRate != nil {
+		cfg.Server.RefreshRate = *s.Server.RefreshRate
+	}
+	if s.Server.Thresholds.CPU != nil {
+		cfg.Server.Thresholds.CPU = *s.Server.Thresholds.CPU
+	}
+	if s.Server.Thresholds.Memory != nil {
+		cfg.Server.Thresholds.Memory = *s.Server.Thresholds.Memory
+	}
+	if s.Server.Thresholds.Disk != nil {
+		cfg.Server.Thresholds.Disk = *s.Server.Thresholds.Disk
+	}
+	if s.Server.Thresholds.Inodes != nil {
+		cfg.Server.Thresholds.Inodes = *s.Server.Thresholds.Inodes
+	}
+	if s.Server.Thresholds.Swap != nil {
+		cfg.Server.Thresholds.Swap = *s.Server.Thresholds.Swap
+	}
+	if s.Server.Thresholds.CPUPressure != nil {
+		cfg.Server.Thresholds.CPUPressure = *s.Server.Thresholds.CPUPressure
+	}
+	if s.Server.Thresholds.MemoryPressure != nil {
+		cfg.Server.Thresholds.MemoryPressure = *s.Server.Thresholds.MemoryPressure
+	}
+	if s.Server.Thresholds.IOPressure != nil {
+		cfg.Server.Thresholds.IOPressure = *s.Server.Thresholds.IOPressure
+	}
+	if s.Containers.RefreshRate != nil {
+		cfg.Containers.RefreshRate = *s.Containers.RefreshRate
+	}
+	if s.Containers.Services.Include != nil {
+		cfg.Containers.Services.Include = *s.Containers.Services.Include
+	}
+	if s.Containers.Services.Exclude != nil {
+		cfg.Containers.Services.Exclude = *s.Containers.Services.Exclude
+	}
+}
+
+// EffectiveSettings returns the runtime-changeable fields of a configuration
+func EffectiveSettings(cfg *Config) *RuntimeSettings {
+	include := append([]string{}, cfg.Containers.Services.Include...)
+	exclude := append([]string{}, cfg.Containers.Services.Exclude...)
+
+	s := &RuntimeSettings{}
+	s.Server.RefreshRate = &cfg.Server.RefreshRate
+	s.Server.Thresholds.CPU = &cfg.Server.Thresholds.CPU
+	s.Server.Thresholds.Memory = &cfg.Server.Thresholds.Memory
+	s.Server.Thresholds.Disk = &cfg.Server.Thresholds.Disk
+	s.Server.Thresholds.Inodes = &cfg.Server.Thresholds.Inodes
+	s.Server.Thresholds.Swap = &cfg.Server.Thresholds.Swap
+	s.Server.Thresholds.CPUPressure = &cfg.Server.Thresholds.CPUPressure
+	s.Server.Thresholds.MemoryPressure = &cfg.Server.Thresholds.MemoryPressure
+	s.Server.Thresholds.IOPressure = &cfg.Server.Thresholds.IOPressure
+	s.Containers.RefreshRate = &cfg.Containers.RefreshRate
+	s.Containers.Services.Include = &include
+	s.Containers.Services.Exclude = &exclude
+	return s.Clone()
+}
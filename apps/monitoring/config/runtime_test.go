@@ -0,0 +1,144 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func mergeAll(t *testing.T, patches ...string) *RuntimeSettings {
+	t.Helper()
+
+	settings := &RuntimeSettings{}
+	for _, patch := range patches {
+		if err := settings.Merge([]byte(patch)); err != nil {
+			t.Fatalf("Merge(%s): %v", patch, err)
+		}
+	}
+	return settings
+}
+
+func TestRuntimeSettingsMerge(t *testing.T) {
+	// Nested objects are merged, so a later patch keeps the other fields
+	settings := mergeAll(t,
+		`{"server":{"refreshRate":30,"thresholds":{"cpu":80}}}`,
+		`{"server":{"thresholds":{"memory":90}}}`,
+	)
+	if settings.Server.RefreshRate == nil || *settings.Server.RefreshRate != 30 {
+		t.Errorf("got refreshRate %v, want 30", settings.Server.RefreshRate)
+	}
+	if settings.Server.Thresholds.CPU == nil || *settings.Server.Thresholds.CPU != 80 ||
+		settings.Server.Thresholds.Memory == nil || *settings.Server.Thresholds.Memory != 90 {
+		t.Errorf("got thresholds %+v, want cpu 80 and memory 90", settings.Server.Thresholds)
+	}
+
+	// null clears an override
+	if err := settings.Merge([]byte(`{"server":{"thresholds":{"cpu":null}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if settings.Server.Thresholds.CPU != nil || settings.Server.Thresholds.Memory == nil {
+		t.Errorf("got thresholds %+v, want only memory", settings.Server.Thresholds)
+	}
+}
+
+func TestRuntimeSettingsMergeLists(t *testing.T) {
+	// Lists are replaced, not appended to
+	settings := mergeAll(t,
+		`{"containers":{"services":{"include":["shop","blog"]}}}`,
+		`{"containers":{"services":{"include":["crm"]}}}`,
+	)
+	if want := []string{"crm"}; !reflect.DeepEqual(*settings.Containers.Services.Include, want) {
+		t.Errorf("got include %q, want %q", *settings.Containers.Services.Include, want)
+	}
+
+	// An empty list is an override that selects nothing, unlike null
+	settings = mergeAll(t, `{"containers":{"services":{"exclude":[]}}}`)
+	if settings.Containers.Services.Exclude == nil || len(*settings.Containers.Services.Exclude) != 0 {
+		t.Errorf("got exclude %v, want an empty override", settings.Containers.Services.Exclude)
+	}
+	if err := settings.Merge([]byte(`{"containers":{"services":{"exclude":null}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if settings.Containers.Services.Exclude != nil {
+		t.Errorf("got exclude %v, want no override", *settings.Containers.Services.Exclude)
+	}
+}
+
+func TestRuntimeSettingsMergeRejectsOtherFields(t *testing.T) {
+	for _, patch := range []string{
+		`{"server":{"port":4000}}`,
+		`{"server":{"token":"secret"}}`,
+		`{"containers":{"backend":"cgroup"}}`,
+		`{"server":{"thresholds":{"cpu":"80"}}}`,
+	} {
+		settings := mergeAll(t, `{"server":{"refreshRate":30}}`)
+		if err := settings.Merge([]byte(patch)); err == nil {
+			t.Errorf("Merge(%s): expected an error", patch)
+		}
+	}
+}
+
+func TestRuntimeSettingsClone(t *testing.T) {
+	settings := mergeAll(t, `{"server":{"thresholds":{"cpu":80}},"containers":{"services":{"include":["shop"]}}}`)
+
+	clone := settings.Clone()
+	*clone.Server.Thresholds.CPU = 50
+	(*clone.Containers.Services.Include)[0] = "blog"
+
+	if *settings.Server.Thresholds.CPU != 80 || (*settings.Containers.Services.Include)[0] != "shop" {
+		t.Error("changing the clone changed the original")
+	}
+}
+
+func TestRuntimeSettingsShadowConfig(t *testing.T) {
+	t.Setenv("METRICS_CONFIG_FILE", "")
+	t.Setenv("METRICS_CONFIG", `{"server":{"token":"t","urlCallback":"http://dokploy/alerts","thresholds":{"cpu":50,"memory":60}}}`)
+
+	settings := mergeAll(t, `{"server":{"thresholds":{"cpu":80}}}`)
+	load := func() *Config {
+		t.Helper()
+		cfg, err := LoadMetricsConfigWith(settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cfg
+	}
+
+	if cfg := load(); cfg.Server.Thresholds.CPU != 80 || cfg.Server.Thresholds.Memory != 60 {
+		t.Errorf("got thresholds %+v, want cpu from the API and memory from the config", cfg.Server.Thresholds)
+	}
+
+	// A later edit of the same field is shadowed by the API value...
+	t.Setenv("METRICS_SERVER_THRESHOLDS_CPU", "70")
+	if cfg := load(); cfg.Server.Thresholds.CPU != 80 {
+		t.Errorf("got cpu threshold %d, want the API value", cfg.Server.Thresholds.CPU)
+	}
+
+	// ...until the override is cleared
+	if err := settings.Merge([]byte(`{"server":{"thresholds":{"cpu":null}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := load(); cfg.Server.Thresholds.CPU != 70 {
+		t.Errorf("got cpu threshold %d, want the environment value", cfg.Server.Thresholds.CPU)
+	}
+}
+
+func TestEffectiveSettings(t *testing.T) {
+	cfg := validConfig()
+	cfg.Containers.Services.Include = []string{"shop"}
+
+	settings := EffectiveSettings(cfg)
+	if *settings.Server.RefreshRate != DefaultServerRefreshRate || !reflect.DeepEqual(*settings.Containers.Services.Include, []string{"shop"}) {
+		t.Errorf("got %+v", settings)
+	}
+	// Lists are never null, so GET /config shows an empty exclude list
+	if settings.Containers.Services.Exclude == nil {
+		t.Error("got a null exclude list")
+	}
+
+	// The result does not alias the configuration
+	*settings.Server.RefreshRate = 5
+	(*settings.Containers.Services.Include)[0] = "blog"
+	if cfg.Server.RefreshRate != DefaultServerRefreshRate || cfg.Containers.Services.Include[0] != "shop" {
+		t.Error("changing the settings changed the configuration")
+	}
+}
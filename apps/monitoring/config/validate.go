@@ -0,0 +1,181 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/robfig/cron/v3"
+)
+
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors collects every problem found in a configuration
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, fieldErr := range e {
+		lines[i] = "  " + fieldErr.Error()
+	}
+	return "invalid configuration:\n" + strings.Join(lines, "\n")
+}
+
+var validators []func(*Config) ValidationErrors
+
+// RegisterValidator adds checks owned by other packages, such as the
+// container selector syntax, to every validation
+func RegisterValidator(validator func(*Config) ValidationErrors) {
+	validators = append(validators, validator)
+}
+
+func Validate(cfg *Config) ValidationErrors {
+	var errs ValidationErrors
+	add := func(path, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if cfg.Server.Token == "" {
+		add("server.token", "is required")
+	}
+	if cfg.Server.UrlCallback == "" {
+		add("server.urlCallback", "is required")
+	}
+	if cfg.Server.RefreshRate <= 0 {
+		add("server.refreshRate", "must be greater than 0, got %d", cfg.Server.RefreshRate)
+	}
+	if cfg.Server.Port < 1 || cfg.Server.Port > 65535 {
+		add("server.port", "must be between 1 and 65535, got %d", cfg.Server.Port)
+	}
+	if cfg.Server.RetentionDays <= 0 {
+		add("server.retentionDays", "must be greater than 0, got %d", cfg.Server.RetentionDays)
+	}
+	if _, err := cron.ParseStandard(cfg.Server.CronJob); err != nil {
+		add("server.cronJob", "invalid cron expression %q: %v", cfg.Server.CronJob, err)
+	}
+	if cfg.Server.Thresholds.CPU < 0 || cfg.Server.Thresholds.CPU > 100 {
+		add("server.thresholds.cpu", "must be between 0 and 100, got %d", cfg.Server.Thresholds.CPU)
+	}
+	if cfg.Server.Thresholds.Memory < 0 || cfg.Server.Thresholds.Memory > 100 {
+		add("server.thresholds.memory", "must be between 0 and 100, got %d", cfg.Server.Thresholds.Memory)
+	}
+	if cfg.Server.Thresholds.Disk < 0 || cfg.Server.Thresholds.Disk > 100 {
+		add("server.thresholds.disk", "must be between 0 and 100, got %d", cfg.Server.Thresholds.Disk)
+	}
+	if cfg.Server.Thresholds.Inodes < 0 || cfg.Server.Thresholds.Inodes > 100 {
+		add("server.thresholds.inodes", "must be between 0 and 100, got %d", cfg.Server.Thresholds.Inodes)
+	}
+	if cfg.Server.Thresholds.Swap < 0 || cfg.Server.Thresholds.Swap > 100 {
+		add("server.thresholds.swap", "must be between 0 and 100, got %d", cfg.Server.Thresholds.Swap)
+	}
+	if cfg.Server.Thresholds.CPUPressure < 0 || cfg.Server.Thresholds.CPUPressure > 100 {
+		add("server.thresholds.cpuPressure", "must be between 0 and 100, got %d", cfg.Server.Thresholds.CPUPressure)
+	}
+	if cfg.Server.Thresholds.MemoryPressure < 0 || cfg.Server.Thresholds.MemoryPressure > 100 {
+		add("server.thresholds.memoryPressure", "must be between 0 and 100, got %d", cfg.Server.Thresholds.MemoryPressure)
+	}
+	if cfg.Server.Thresholds.IOPressure < 0 || cfg.Server.Thresholds.IOPressure > 100 {
+		add("server.thresholds.ioPressure", "must be between 0 and 100, got %d", cfg.Server.Thresholds.IOPressure)
+	}
+	if !strings.HasPrefix(cfg.Server.HostRoot, "/") {
+		add("server.hostRoot", "must be an absolute path, got %q", cfg.Server.HostRoot)
+	}
+	if !strings.HasPrefix(cfg.Server.ProcRoot, "/") {
+		add("server.procRoot", "must be an absolute path, got %q", cfg.Server.ProcRoot)
+	}
+	for i, pattern := range cfg.Server.Network.Include {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			add(fmt.Sprintf("server.network.include[%d]", i), "invalid interface pattern %q", pattern)
+		}
+	}
+	for i, pattern := range cfg.Server.Network.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			add(fmt.Sprintf("server.network.exclude[%d]", i), "invalid interface pattern %q", pattern)
+		}
+	}
+	for i, mountpoint := range cfg.Server.Disk.Mountpoints {
+		if !strings.HasPrefix(mountpoint, "/") {
+			add(fmt.Sprintf("server.disk.mountpoints[%d]", i), "must be an absolute path, got %q", mountpoint)
+		}
+	}
+	if cfg.Server.Processes.Count < 0 || cfg.Server.Processes.Count > 100 {
+		add("server.processes.count", "must be between 0 and 100, got %d", cfg.Server.Processes.Count)
+	}
+	if cfg.Server.Processes.RetentionHours <= 0 {
+		add("server.processes.retentionHours", "must be greater than 0, got %d", cfg.Server.Processes.RetentionHours)
+	}
+
+	if cfg.Containers.RefreshRate <= 0 {
+		add("containers.refreshRate", "must be greater than 0, got %d", cfg.Containers.RefreshRate)
+	}
+	if cfg.Containers.DockerSocket == "" {
+		add("containers.dockerSocket", "is required")
+	}
+	switch cfg.Containers.Backend {
+	case "docker", "cgroup":
+	default:
+		add("containers.backend", "must be \"docker\" or \"cgroup\", got %q", cfg.Containers.Backend)
+	}
+	if cfg.Containers.Backend == "cgroup" && cfg.Containers.CgroupRoot == "" {
+		add("containers.cgroupRoot", "is required with the cgroup backend")
+	}
+	if cfg.Containers.Filesystem.RefreshRate < 0 {
+		add("containers.filesystem.refreshRate", "must be 0 (disabled) or greater, got %d", cfg.Containers.Filesystem.RefreshRate)
+	}
+	if cfg.Containers.DiskUsage.RefreshRate < 0 {
+		add("containers.diskUsage.refreshRate", "must be 0 (disabled) or greater, got %d", cfg.Containers.DiskUsage.RefreshRate)
+	}
+
+	for _, validator := range validators {
+		errs = append(errs, validator(cfg)...)
+	}
+
+	return errs
+}
+
+// legacyFields are the fields older versions accepted without checking them.
+// An invalid value there is replaced by the default with a warning instead
+// of failing, so a METRICS_CONFIG that used to start keeps starting.
+var legacyFields = map[string]func(cfg, defaults *Config){
+	"server.refreshRate":       func(cfg, defaults *Config) { cfg.Server.RefreshRate = defaults.Server.RefreshRate },
+	"server.port":              func(cfg, defaults *Config) { cfg.Server.Port = defaults.Server.Port },
+	"server.retentionDays":     func(cfg, defaults *Config) { cfg.Server.RetentionDays = defaults.Server.RetentionDays },
+	"server.cronJob":           func(cfg, defaults *Config) { cfg.Server.CronJob = defaults.Server.CronJob },
+	"server.thresholds.cpu":    func(cfg, defaults *Config) { cfg.Server.Thresholds.CPU = defaults.Server.Thresholds.CPU },
+	"server.thresholds.memory": func(cfg, defaults *Config) { cfg.Server.Thresholds.Memory = defaults.Server.Thresholds.Memory },
+	"containers.refreshRate":   func(cfg, defaults *Config) { cfg.Containers.RefreshRate = defaults.Containers.RefreshRate },
+}
+
+// relaxLegacyFields resets the invalid legacy fields of the file or
+// environment configuration and returns a warning for each. It runs before
+// the runtime settings are applied, which are always validated strictly.
+func relaxLegacyFields(cfg *Config) ValidationErrors {
+	var warnings ValidationErrors
+	defaults := DefaultConfig()
+	for _, fieldErr := range Validate(cfg) {
+		if reset, ok := legacyFields[fieldErr.Path]; ok {
+			reset(cfg, defaults)
+			fieldErr.Message += ", using the default"
+			warnings = append(warnings, fieldErr)
+		}
+	}
+
+	// Alerts are only sent to http(s) URLs, but the agent can run without them
+	if callback := cfg.Server.UrlCallback; callback != "" {
+		if u, err := url.Parse(callback); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			warnings = append(warnings, FieldError{
+				Path:    "server.urlCallback",
+				Message: fmt.Sprintf("is not an http(s) URL, alerts will fail: %q", callback),
+			})
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func validConfig() *Config {
+	cfg := DefaultConfig()
+	cfg.Server.Token = "token"
+	cfg.Server.UrlCallback = "http://dokploy:3000/api/alerts"
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	if errs := Validate(validConfig()); len(errs) > 0 {
+		t.Fatalf("defaults with a token and callback: %v", errs)
+	}
+
+	tests := []struct {
+		path   string
+		change func(cfg *Config)
+	}{
+		{"server.token", func(cfg *Config) { cfg.Server.Token = "" }},
+		{"server.urlCallback", func(cfg *Config) { cfg.Server.UrlCallback = "" }},
+		{"server.refreshRate", func(cfg *Config) { cfg.Server.RefreshRate = 0 }},
+		{"server.port", func(cfg *Config) { cfg.Server.Port = 70000 }},
+		{"server.retentionDays", func(cfg *Config) { cfg.Server.RetentionDays = -1 }},
+		{"server.cronJob", func(cfg *Config) { cfg.Server.CronJob = "every day" }},
+		{"server.thresholds.disk", func(cfg *Config) { cfg.Server.Thresholds.Disk = 101 }},
+		{"server.hostRoot", func(cfg *Config) { cfg.Server.HostRoot = "host" }},
+		{"server.network.include[1]", func(cfg *Config) { cfg.Server.Network.Include = []string{"eth*", "[eth"} }},
+		{"server.processes.count", func(cfg *Config) { cfg.Server.Processes.Count = 500 }},
+		{"containers.backend", func(cfg *Config) { cfg.Containers.Backend = "cri" }},
+		{"containers.cgroupRoot", func(cfg *Config) {
+			cfg.Containers.Backend = "cgroup"
+			cfg.Containers.CgroupRoot = ""
+		}},
+		{"containers.filesystem.refreshRate", func(cfg *Config) { cfg.Containers.Filesystem.RefreshRate = -1 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			cfg := validConfig()
+			tt.change(cfg)
+
+			errs := Validate(cfg)
+			if len(errs) != 1 || errs[0].Path != tt.path {
+				t.Errorf("got %v, want one error for %s", errs, tt.path)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryError(t *testing.T) {
+	cfg := validConfig()
+	cfg.Server.Token = ""
+	cfg.Server.Port = 0
+	cfg.Containers.DockerSocket = ""
+
+	errs := Validate(cfg)
+	if len(errs) != 3 {
+		t.Fatalf("got %v, want 3 errors", errs)
+	}
+	if !strings.Contains(errs.Error(), "server.port: must be between 1 and 65535, got 0") {
+		t.Errorf("got %q", errs.Error())
+	}
+}
+
+func TestRelaxLegacyFields(t *testing.T) {
+	cfg := validConfig()
+	cfg.Server.RefreshRate = 0
+	cfg.Server.CronJob = "daily"
+	cfg.Server.Thresholds.CPU = 150
+	cfg.Server.UrlCallback = "dokploy:3000/api/alerts"
+	// Not a legacy field: stays invalid
+	cfg.Server.Thresholds.Disk = 150
+
+	warnings := relaxLegacyFields(cfg)
+	if len(warnings) != 4 {
+		t.Fatalf("got %v, want 4 warnings", warnings)
+	}
+	if cfg.Server.RefreshRate != DefaultServerRefreshRate || cfg.Server.CronJob != DefaultCronJob || cfg.Server.Thresholds.CPU != 0 {
+		t.Errorf("got refreshRate %d, cronJob %q and cpu threshold %d, want the defaults",
+			cfg.Server.RefreshRate, cfg.Server.CronJob, cfg.Server.Thresholds.CPU)
+	}
+	// The callback has no default and is kept
+	if cfg.Server.UrlCallback != "dokploy:3000/api/alerts" {
+		t.Errorf("got urlCallback %q", cfg.Server.UrlCallback)
+	}
+
+	errs := Validate(cfg)
+	if len(errs) != 1 || errs[0].Path != "server.thresholds.disk" {
+		t.Errorf("got %v, want only the disk threshold error", errs)
+	}
+}
+
+func TestLoadMetricsConfig(t *testing.T) {
+	t.Setenv("METRICS_CONFIG_FILE", "")
+
+	tests := []struct {
+		name      string
+		env       string
+		overrides string
+		wantErr   string
+		check     func(t *testing.T, cfg *Config)
+	}{
+		{
+			name: "valid",
+			env:  `{"server":{"token":"t","urlCallback":"http://dokploy/alerts","refreshRate":30}}`,
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Server.RefreshRate != 30 || cfg.Server.Port != DefaultPort {
+					t.Errorf("got refreshRate %d and port %d", cfg.Server.RefreshRate, cfg.Server.Port)
+				}
+			},
+		},
+		{
+			// Accepted by older versions, so the default is used
+			name: "invalid legacy field",
+			env:  `{"server":{"token":"t","urlCallback":"http://dokploy/alerts","refreshRate":0,"thresholds":{"cpu":150}}}`,
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Server.RefreshRate != DefaultServerRefreshRate || cfg.Server.Thresholds.CPU != 0 {
+					t.Errorf("got refreshRate %d and cpu threshold %d", cfg.Server.RefreshRate, cfg.Server.Thresholds.CPU)
+				}
+			},
+		},
+		{
+			name:    "invalid new field",
+			env:     `{"server":{"token":"t","urlCallback":"http://dokploy/alerts","thresholds":{"disk":150}}}`,
+			wantErr: "server.thresholds.disk",
+		},
+		{
+			name:    "unknown field",
+			env:     `{"server":{"token":"t","urlCallback":"http://dokploy/alerts","refreshInterval":30}}`,
+			wantErr: `unknown field "refreshInterval"`,
+		},
+		{
+			name:    "missing token",
+			env:     `{"server":{"urlCallback":"http://dokploy/alerts"}}`,
+			wantErr: "server.token: is required",
+		},
+		{
+			// Runtime settings are checked strictly, even for legacy fields
+			name:      "invalid runtime setting",
+			env:       `{"server":{"token":"t","urlCallback":"http://dokploy/alerts"}}`,
+			overrides: `{"server":{"thresholds":{"cpu":150}}}`,
+			wantErr:   "server.thresholds.cpu",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("METRICS_CONFIG", tt.env)
+
+			overrides := &RuntimeSettings{}
+			if tt.overrides != "" {
+				if err := overrides.Merge([]byte(tt.overrides)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cfg, err := LoadMetricsConfigWith(overrides)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadMetricsConfigWith: %v", err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestLoadMetricsConfigValidationErrors(t *testing.T) {
+	t.Setenv("METRICS_CONFIG_FILE", "")
+	t.Setenv("METRICS_CONFIG", `{"server":{"token":"t","urlCallback":"http://dokploy/alerts"}}`)
+	t.Setenv("METRICS_SERVER_PROCESSES_COUNT", "many")
+	t.Setenv("METRICS_CONTAINERS_BACKEND", "cri")
+
+	_, err := LoadMetricsConfigWith(nil)
+	var errs ValidationErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("got %v, want the environment and validation errors together", err)
+	}
+}
@@ -0,0 +1,518 @@
+package containers
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/mem"
+
+	"github.com/mauriciogm/dokploy/apps/monitoring/database"
+)
+
+// Matches both the cgroupfs driver layout (docker/<id>) and the systemd
+// driver layout (system.slice/docker-<id>.scope)
+var containerCgroupPattern = regexp.MustCompile(`^(?:docker-)?([0-9a-f]{64})(?:\.scope)?$`)
+
+// CgroupCollector reads container metrics straight from the cgroup
+// filesystem, supporting both the v1 hierarchy and the unified v2 one
+type CgroupCollector struct {
+	root     string
+	procRoot string
+	cgroups  cgroupPaths
+
+	mu       sync.Mutex
+	previous map[string]cpuSample
+}
+
+type cpuSample struct {
+	usage uint64 // nanoseconds
+	at    time.Time
+}
+
+type cgroupStats struct {
+	cpuUsage     uint64 // nanoseconds
+	memUsage     uint64
+	memLimit     uint64 // 0 when unlimited
+	inactiveFile uint64
+	ioRead       uint64
+	ioWrite      uint64
+	pids         uint64
+	pidsLimit    uint64 // 0 when unlimited
+	processes    uint64
+	fds          uint64
+	netRx        uint64
+	netTx        uint64
+	pressure     *database.PressureMetric      // nil on cgroup v1
+	throttling   *database.ContainerThrottling // nil without the CFS bandwidth controller
+}
+
+func NewCgroupCollector(root, procRoot string) *CgroupCollector {
+	return &CgroupCollector{
+		root:     root,
+		procRoot: procRoot,
+		previous: make(map[string]cpuSample),
+	}
+}
+
+func isUnifiedCgroup(root string) bool {
+	_, err := os.Stat(filepath.Join(root, "cgroup.controllers"))
+	return err == nil
+}
+
+// cgroupDiscoveryRoot is where the container directories are looked for. On
+// v1 every controller mirrors the same layout, so the memory controller is
+// enough to find them.
+func cgroupDiscoveryRoot(root string, unified bool) string {
+	if unified {
+		return root
+	}
+	return filepath.Join(root, "memory")
+}
+
+func (cc *CgroupCollector) Collect(containers []DockerContainer, pids map[string]int) []*database.ContainerMetric {
+	unified := isUnifiedCgroup(cc.root)
+
+	paths, err := cc.cgroups.lookup(cgroupDiscoveryRoot(cc.root, unified), containers, pids)
+	if err != nil {
+		log.Printf("Error discovering container cgroups: %v", err)
+		return nil
+	}
+
+	var hostMemory uint64
+	if v, err := mem.VirtualMemory(); err == nil {
+		hostMemory = v.Total
+	}
+
+	now := time.Now()
+	seen := make(map[string]bool)
+	var metrics []*database.ContainerMetric
+
+	for _, container := range containers {
+		name := containerName(container)
+
+		rel, ok := paths[container.ID]
+		if !ok {
+			log.Printf("No cgroup found for container %s", name)
+			continue
+		}
+
+		var stats *cgroupStats
+		if unified {
+			stats, err = cc.readCgroupV2(rel)
+		} else {
+			stats, err = cc.readCgroupV1(rel)
+		}
+		if err != nil {
+			log.Printf("Error reading cgroup stats for %s: %v", name, err)
+			continue
+		}
+		cc.readNetwork(pids[container.ID], stats)
+
+		seen[container.ID] = true
+		metrics = append(metrics, cc.buildMetric(container, stats, hostMemory, now))
+	}
+
+	// Forget containers that went away so their samples do not leak
+	cc.mu.Lock()
+	for id := range cc.previous {
+		if !seen[id] {
+			delete(cc.previous, id)
+		}
+	}
+	cc.mu.Unlock()
+
+	return metrics
+}
+
+// cgroupPaths caches the cgroup directory of each container between
+// collections. The hierarchy is only walked again when a container is
+// missing from it, which is how new containers are found.
+type cgroupPaths struct {
+	mu    sync.Mutex
+	root  string
+	paths map[string]string
+
+	// missing holds the PID of the containers the last walk did not find.
+	// Their cgroup is not looked for again until they run a new process,
+	// so a container outside the hierarchy does not cause a walk on every
+	// collection.
+	missing map[string]int
+}
+
+// lookup returns the directories of the containers relative to root. The
+// map returned is replaced, never modified, by later walks.
+func (cp *cgroupPaths) lookup(root string, containers []DockerContainer, pids map[string]int) (map[string]string, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	walk := cp.paths == nil || cp.root != root
+	for _, container := range containers {
+		if _, ok := cp.paths[container.ID]; ok {
+			continue
+		}
+		if pid, ok := cp.missing[container.ID]; !ok || pid != pids[container.ID] {
+			walk = true
+			break
+		}
+	}
+	if !walk {
+		return cp.paths, nil
+	}
+
+	paths, err := discoverContainerCgroups(root)
+	if err != nil {
+		return nil, err
+	}
+	missing := make(map[string]int)
+	for _, container := range containers {
+		if _, ok := paths[container.ID]; !ok {
+			missing[container.ID] = pids[container.ID]
+		}
+	}
+	cp.root, cp.paths, cp.missing = root, paths, missing
+	return paths, nil
+}
+
+// discoverContainerCgroups maps container IDs to their cgroup directory,
+// relative to the hierarchy root
+func discoverContainerCgroups(root string) (map[string]string, error) {
+	paths := make(map[string]string)
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		if match := containerCgroupPattern.FindStringSubmatch(d.Name()); match != nil {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			paths[match[1]] = rel
+			return filepath.SkipDir
+		}
+		return nil
+	})
+
+	return paths, err
+}
+
+func (cc *CgroupCollector) readCgroupV2(rel string) (*cgroupStats, error) {
+	dir := filepath.Join(cc.root, rel)
+	stats := &cgroupStats{}
+
+	cpuStat, err := readKeyValueFile(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return nil, err
+	}
+	stats.cpuUsage = cpuStat["usage_usec"] * 1000
+	if _, ok := cpuStat["nr_periods"]; ok {
+		stats.throttling = &database.ContainerThrottling{
+			Periods:          cpuStat["nr_periods"],
+			ThrottledPeriods: cpuStat["nr_throttled"],
+			ThrottledTime:    cpuStat["throttled_usec"] * 1000,
+		}
+	}
+
+	if stats.memUsage, err = readUintFile(filepath.Join(dir, "memory.current")); err != nil {
+		return nil, err
+	}
+	if stats.memLimit, err = readUintFile(filepath.Join(dir, "memory.max")); err != nil {
+		return nil, err
+	}
+	if memStat, err := readKeyValueFile(filepath.Join(dir, "memory.stat")); err == nil {
+		stats.inactiveFile = memStat["inactive_file"]
+	}
+
+	if stats.ioRead, stats.ioWrite, err = readIOStatV2(filepath.Join(dir, "io.stat")); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	stats.pids, _ = readUintFile(filepath.Join(dir, "pids.current"))
+	stats.pidsLimit, _ = readUintFile(filepath.Join(dir, "pids.max"))
+	stats.processes, stats.fds = readProcesses(filepath.Join(dir, "cgroup.procs"), cc.procRoot)
+	stats.pressure = readCgroupPressure(dir)
+
+	return stats, nil
+}
+
+func (cc *CgroupCollector) readCgroupV1(rel string) (*cgroupStats, error) {
+	stats := &cgroupStats{}
+	var err error
+
+	cpuDir := cc.v1ControllerDir(rel, "cpuacct", "cpu,cpuacct")
+	if stats.cpuUsage, err = readUintFile(filepath.Join(cpuDir, "cpuacct.usage")); err != nil {
+		return nil, err
+	}
+	if cpuStat, err := readKeyValueFile(filepath.Join(cc.v1ControllerDir(rel, "cpu", "cpu,cpuacct"), "cpu.stat")); err == nil {
+		stats.throttling = &database.ContainerThrottling{
+			Periods:          cpuStat["nr_periods"],
+			ThrottledPeriods: cpuStat["nr_throttled"],
+			ThrottledTime:    cpuStat["throttled_time"],
+		}
+	}
+
+	memDir := filepath.Join(cc.root, "memory", rel)
+	if stats.memUsage, err = readUintFile(filepath.Join(memDir, "memory.usage_in_bytes")); err != nil {
+		return nil, err
+	}
+	if stats.memLimit, err = readUintFile(filepath.Join(memDir, "memory.limit_in_bytes")); err != nil {
+		return nil, err
+	}
+	if memStat, err := readKeyValueFile(filepath.Join(memDir, "memory.stat")); err == nil {
+		stats.inactiveFile = memStat["total_inactive_file"]
+	}
+
+	blkioDir := filepath.Join(cc.root, "blkio", rel)
+	stats.ioRead, stats.ioWrite, err = readBlkioV1(filepath.Join(blkioDir, "blkio.throttle.io_service_bytes_recursive"))
+	if os.IsNotExist(err) {
+		stats.ioRead, stats.ioWrite, err = readBlkioV1(filepath.Join(blkioDir, "blkio.throttle.io_service_bytes"))
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	stats.pids, _ = readUintFile(filepath.Join(cc.root, "pids", rel, "pids.current"))
+	stats.pidsLimit, _ = readUintFile(filepath.Join(cc.root, "pids", rel, "pids.max"))
+	stats.processes, stats.fds = readProcesses(filepath.Join(memDir, "cgroup.procs"), cc.procRoot)
+
+	return stats, nil
+}
+
+// v1ControllerDir returns the first existing directory among the possible
+// mount names of a controller (distributions mount cpu and cpuacct differently)
+func (cc *CgroupCollector) v1ControllerDir(rel string, controllers ...string) string {
+	for _, controller := range controllers {
+		dir := filepath.Join(cc.root, controller, rel)
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+	}
+	return filepath.Join(cc.root, controllers[0], rel)
+}
+
+// readNetwork sums the interface counters seen from the network namespace
+// of the container init process. Cgroups do not account network traffic.
+// The PID comes from the inspect, which is in the host PID namespace like
+// procRoot; cgroup.procs lists PIDs in the namespace of the agent instead.
+func (cc *CgroupCollector) readNetwork(pid int, stats *cgroupStats) {
+	if pid <= 0 {
+		return
+	}
+
+	file, err := os.Open(filepath.Join(cc.procRoot, strconv.Itoa(pid), "net", "dev"))
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		iface, counters, found := strings.Cut(scanner.Text(), ":")
+		if !found || strings.TrimSpace(iface) == "lo" {
+			continue
+		}
+		values := strings.Fields(counters)
+		if len(values) < 9 {
+			continue
+		}
+		rx, _ := strconv.ParseUint(values[0], 10, 64)
+		tx, _ := strconv.ParseUint(values[8], 10, 64)
+		stats.netRx += rx
+		stats.netTx += tx
+	}
+}
+
+func (cc *CgroupCollector) buildMetric(container DockerContainer, stats *cgroupStats, hostMemory uint64, now time.Time) *database.ContainerMetric {
+	// CPU is the share of one core used since the previous sample, which is
+	// the same scale `docker stats` reports (100% per fully used core)
+	var cpu float64
+	cc.mu.Lock()
+	if prev, ok := cc.previous[container.ID]; ok && stats.cpuUsage >= prev.usage {
+		if elapsed := now.Sub(prev.at); elapsed > 0 {
+			cpu = float64(stats.cpuUsage-prev.usage) / float64(elapsed.Nanoseconds()) * 100
+		}
+	}
+	cc.previous[container.ID] = cpuSample{usage: stats.cpuUsage, at: now}
+	cc.mu.Unlock()
+
+	memUsed := stats.memUsage
+	if stats.inactiveFile < memUsed {
+		memUsed -= stats.inactiveFile
+	}
+
+	// Unlimited cgroups report "max" (v2) or a page-aligned int64 max (v1)
+	memLimit := stats.memLimit
+	if memLimit == 0 || (hostMemory > 0 && memLimit > hostMemory) {
+		memLimit = hostMemory
+	}
+
+	id := shortID(container.ID)
+
+	return &database.ContainerMetric{
+		Timestamp:  now.UTC().Format(time.RFC3339Nano),
+		CPU:        round2(cpu),
+		Memory:     database.NewMemoryMetric(memUsed, memLimit),
+		Network:    database.NewNetworkMetric(stats.netRx, stats.netTx),
+		BlockIO:    database.NewBlockIOMetric(stats.ioRead, stats.ioWrite),
+		Pids:       stats.pids,
+		PidsLimit:  stats.pidsLimit,
+		Processes:  stats.processes,
+		FDs:        stats.fds,
+		Pressure:   stats.pressure,
+		Throttling: stats.throttling,
+		Container:  id,
+		ID:         id,
+		Name:       containerName(container),
+	}
+}
+
+// readProcesses counts the processes of a cgroup and the file descriptors
+// they have open. The fd directories of other users' processes can only be
+// read by root; those are left out of the count. cgroup.procs lists the
+// processes outside the PID namespace of the agent as 0, so their
+// descriptors can only be counted when it shares the host one.
+func readProcesses(procsFile, procRoot string) (processes, fds uint64) {
+	content, err := os.ReadFile(procsFile)
+	if err != nil {
+		return 0, 0
+	}
+	for _, pid := range strings.Fields(string(content)) {
+		processes++
+		if pid == "0" {
+			continue
+		}
+		dir, err := os.Open(filepath.Join(procRoot, pid, "fd"))
+		if err != nil {
+			continue
+		}
+		names, _ := dir.Readdirnames(-1)
+		dir.Close()
+		fds += uint64(len(names))
+	}
+	return processes, fds
+}
+
+// readCgroupPressure reads the cpu.pressure, memory.pressure and io.pressure
+// files of a cgroup v2 directory. It returns nil when none can be read, such
+// as when the kernel was booted with psi=0.
+func readCgroupPressure(dir string) *database.PressureMetric {
+	pressure := &database.PressureMetric{}
+	found := false
+	for name, resource := range pressure.Resources() {
+		content, err := os.ReadFile(filepath.Join(dir, name+".pressure"))
+		if err != nil {
+			continue
+		}
+		if parsed, err := database.ParsePressure(string(content)); err == nil {
+			*resource = parsed
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return pressure
+}
+
+// readUintFile reads a single-value cgroup file. "max" is returned as 0.
+func readUintFile(path string) (uint64, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(content))
+	if value == "max" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+	return n, nil
+}
+
+// readKeyValueFile reads flat keyed files like cpu.stat and memory.stat
+func readKeyValueFile(path string) (map[string]uint64, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]uint64)
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if n, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = n
+		}
+	}
+	return values, nil
+}
+
+// readIOStatV2 sums rbytes/wbytes over every device in io.stat
+func readIOStatV2(path string) (uint64, uint64, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var read, write uint64
+	for _, line := range strings.Split(string(content), "\n") {
+		for _, field := range strings.Fields(line) {
+			key, value, found := strings.Cut(field, "=")
+			if !found {
+				continue
+			}
+			n, _ := strconv.ParseUint(value, 10, 64)
+			switch key {
+			case "rbytes":
+				read += n
+			case "wbytes":
+				write += n
+			}
+		}
+	}
+	return read, write, nil
+}
+
+// readBlkioV1 sums the Read/Write lines of a blkio.throttle.io_service_bytes file
+func readBlkioV1(path string) (uint64, uint64, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var read, write uint64
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		n, _ := strconv.ParseUint(fields[2], 10, 64)
+		switch fields[1] {
+		case "Read":
+			read += n
+		case "Write":
+			write += n
+		}
+	}
+	return read, write, nil
+}
@@ -0,0 +1,274 @@
+package containers
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mauriciogm/dokploy/apps/monitoring/database"
+)
+
+var (
+	containerA = strings.Repeat("a", 64)
+	containerB = strings.Repeat("b", 64)
+	containerC = strings.Repeat("c", 64)
+)
+
+const (
+	cgroupV1Root = "testdata/cgroup/v1"
+	cgroupV2Root = "testdata/cgroup/v2"
+	procRoot     = "testdata/proc"
+)
+
+func TestDiscoverContainerCgroups(t *testing.T) {
+	// The systemd driver names the directories docker-<id>.scope, the
+	// cgroupfs driver docker/<id>
+	tests := []struct {
+		name string
+		root string
+		want map[string]string
+	}{
+		{
+			name: "v2",
+			root: cgroupV2Root,
+			want: map[string]string{
+				containerA: filepath.Join("system.slice", "docker-"+containerA+".scope"),
+				containerB: filepath.Join("docker", containerB),
+				// A Swarm task created with a custom --cgroup-parent
+				containerC: filepath.Join("swarm.slice", "docker-"+containerC+".scope"),
+			},
+		},
+		{
+			name: "v1",
+			root: cgroupDiscoveryRoot(cgroupV1Root, false),
+			want: map[string]string{
+				containerA: filepath.Join("docker", containerA),
+				containerB: filepath.Join("system.slice", "docker-"+containerB+".scope"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := discoverContainerCgroups(tt.root)
+			if err != nil {
+				t.Fatalf("discoverContainerCgroups: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscoverContainerCgroupsMissingRoot(t *testing.T) {
+	if _, err := discoverContainerCgroups("testdata/cgroup/missing"); err == nil {
+		t.Error("expected an error for a missing root")
+	}
+}
+
+func TestIsUnifiedCgroup(t *testing.T) {
+	if !isUnifiedCgroup(cgroupV2Root) {
+		t.Error("v2 root not detected as unified")
+	}
+	if isUnifiedCgroup(cgroupV1Root) {
+		t.Error("v1 root detected as unified")
+	}
+}
+
+func TestReadCgroupV2(t *testing.T) {
+	cc := NewCgroupCollector(cgroupV2Root, procRoot)
+
+	stats, err := cc.readCgroupV2(filepath.Join("system.slice", "docker-"+containerA+".scope"))
+	if err != nil {
+		t.Fatalf("readCgroupV2: %v", err)
+	}
+
+	want := &cgroupStats{
+		cpuUsage:     5000000000,
+		memUsage:     104857600,
+		memLimit:     209715200,
+		inactiveFile: 4194304,
+		ioRead:       1049600,
+		ioWrite:      2097152,
+		pids:         7,
+		pidsLimit:    0,
+		processes:    2,
+		fds:          5,
+		throttling: &database.ContainerThrottling{
+			Periods:          200,
+			ThrottledPeriods: 50,
+			ThrottledTime:    125000000,
+		},
+		pressure: &database.PressureMetric{
+			CPU: database.PressureResource{
+				Some: database.PressureStall{Avg10: 1.5, Avg60: 0.75, Avg300: 0.25, Total: 123456},
+			},
+			Memory: database.PressureResource{
+				Some: database.PressureStall{Avg10: 0, Avg60: 0.1, Avg300: 0.2, Total: 2000},
+				Full: database.PressureStall{Avg10: 0, Avg60: 0.05, Avg300: 0.1, Total: 1000},
+			},
+			IO: database.PressureResource{
+				Some: database.PressureStall{Avg10: 3, Avg60: 2, Avg300: 1, Total: 90000},
+				Full: database.PressureStall{Avg10: 2.5, Avg60: 1.5, Avg300: 0.5, Total: 80000},
+			},
+		},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("got %+v, want %+v", stats, want)
+	}
+}
+
+func TestReadCgroupV2Minimal(t *testing.T) {
+	cc := NewCgroupCollector(cgroupV2Root, procRoot)
+
+	// No io.stat, no CFS bandwidth counters, no PSI and an unlimited memory
+	stats, err := cc.readCgroupV2(filepath.Join("docker", containerB))
+	if err != nil {
+		t.Fatalf("readCgroupV2: %v", err)
+	}
+	if stats.cpuUsage != 1000000 || stats.memUsage != 1048576 || stats.memLimit != 0 {
+		t.Errorf("got cpu %d, memory %d/%d", stats.cpuUsage, stats.memUsage, stats.memLimit)
+	}
+	if stats.throttling != nil {
+		t.Errorf("got throttling %+v, want nil", stats.throttling)
+	}
+	if stats.pressure != nil {
+		t.Errorf("got pressure %+v, want nil", stats.pressure)
+	}
+}
+
+func TestReadCgroupV1(t *testing.T) {
+	cc := NewCgroupCollector(cgroupV1Root, procRoot)
+
+	stats, err := cc.readCgroupV1(filepath.Join("docker", containerA))
+	if err != nil {
+		t.Fatalf("readCgroupV1: %v", err)
+	}
+
+	want := &cgroupStats{
+		cpuUsage:     7000000000,
+		memUsage:     52428800,
+		memLimit:     9223372036854771712,
+		inactiveFile: 2097152,
+		ioRead:       5120,
+		ioWrite:      8192,
+		pids:         3,
+		pidsLimit:    100,
+		processes:    1,
+		fds:          3,
+		throttling: &database.ContainerThrottling{
+			Periods:          10,
+			ThrottledPeriods: 2,
+			ThrottledTime:    3000000,
+		},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("got %+v, want %+v", stats, want)
+	}
+}
+
+func TestReadCgroupMissing(t *testing.T) {
+	if _, err := NewCgroupCollector(cgroupV2Root, procRoot).readCgroupV2("docker/missing"); err == nil {
+		t.Error("readCgroupV2: expected an error for a missing cgroup")
+	}
+	if _, err := NewCgroupCollector(cgroupV1Root, procRoot).readCgroupV1("docker/missing"); err == nil {
+		t.Error("readCgroupV1: expected an error for a missing cgroup")
+	}
+}
+
+func TestCgroupPathsLookup(t *testing.T) {
+	var cgroups cgroupPaths
+
+	paths, err := cgroups.lookup(cgroupV2Root, []DockerContainer{{ID: containerA}}, nil)
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if len(paths) != 3 {
+		t.Fatalf("got %d paths, want 3", len(paths))
+	}
+
+	// Known containers are served from the cache
+	cgroups.paths = map[string]string{containerA: "cached"}
+	paths, _ = cgroups.lookup(cgroupV2Root, []DockerContainer{{ID: containerA}}, nil)
+	if paths[containerA] != "cached" {
+		t.Errorf("got %q, want the cached path", paths[containerA])
+	}
+
+	// A new container walks the hierarchy again
+	paths, _ = cgroups.lookup(cgroupV2Root, []DockerContainer{{ID: containerA}, {ID: containerB}}, nil)
+	if paths[containerB] != filepath.Join("docker", containerB) {
+		t.Errorf("got %q for the new container", paths[containerB])
+	}
+}
+
+func TestCgroupPathsLookupMissing(t *testing.T) {
+	var cgroups cgroupPaths
+	outside := strings.Repeat("d", 64)
+	containers := []DockerContainer{{ID: containerA}, {ID: outside}}
+
+	paths, err := cgroups.lookup(cgroupV2Root, containers, map[string]int{containerA: 101, outside: 200})
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if _, ok := paths[outside]; ok {
+		t.Fatalf("got a path for a container outside the hierarchy")
+	}
+
+	// The missing container does not walk the hierarchy again...
+	cgroups.paths = map[string]string{containerA: "cached"}
+	paths, _ = cgroups.lookup(cgroupV2Root, containers, map[string]int{containerA: 101, outside: 200})
+	if paths[containerA] != "cached" {
+		t.Errorf("got %q, want the cached path", paths[containerA])
+	}
+
+	// ...until it runs a new process
+	paths, _ = cgroups.lookup(cgroupV2Root, containers, map[string]int{containerA: 101, outside: 300})
+	if paths[containerA] != filepath.Join("system.slice", "docker-"+containerA+".scope") {
+		t.Errorf("got %q, want the hierarchy walked again", paths[containerA])
+	}
+}
+
+func TestReadNetwork(t *testing.T) {
+	cc := NewCgroupCollector(cgroupV2Root, procRoot)
+
+	tests := []struct {
+		name         string
+		pid          int
+		netRx, netTx uint64
+	}{
+		// Loopback is left out
+		{name: "init process", pid: 101, netRx: 123456, netTx: 65432},
+		{name: "stopped container", pid: 0},
+		{name: "unknown process", pid: 999},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := &cgroupStats{}
+			cc.readNetwork(tt.pid, stats)
+			if stats.netRx != tt.netRx || stats.netTx != tt.netTx {
+				t.Errorf("got %d/%d bytes, want %d/%d", stats.netRx, stats.netTx, tt.netRx, tt.netTx)
+			}
+		})
+	}
+}
+
+func TestReadCgroupPressure(t *testing.T) {
+	pressure := readCgroupPressure(filepath.Join(cgroupV2Root, "system.slice", "docker-"+containerA+".scope"))
+	if pressure == nil {
+		t.Fatal("got nil pressure")
+	}
+	// cpu.pressure only has a some line, like on kernels before 5.13
+	if pressure.CPU.Some.Total != 123456 || pressure.CPU.Full != (database.PressureStall{}) {
+		t.Errorf("got cpu pressure %+v", pressure.CPU)
+	}
+	if pressure.IO.Full.Avg10 != 2.5 || pressure.Memory.Full.Total != 1000 {
+		t.Errorf("got io %+v and memory %+v", pressure.IO, pressure.Memory)
+	}
+
+	// Without PSI files, such as with psi=0
+	if pressure := readCgroupPressure(filepath.Join(cgroupV2Root, "docker", containerB)); pressure != nil {
+		t.Errorf("got %+v, want nil", pressure)
+	}
+}
@@ -0,0 +1,82 @@
+package containers
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync"
+
+	"github.com/mauriciogm/dokploy/apps/monitoring/database"
+)
+
+// MetricsCollector reads resource usage for the selected containers. pids
+// maps the full ID of each container to the PID of its init process as
+// reported by the inspect, 0 when unknown.
+type MetricsCollector interface {
+	Collect(containers []DockerContainer, pids map[string]int) []*database.ContainerMetric
+}
+
+func newMetricsCollector(backend string, docker *DockerClient, cgroupRoot, procRoot string) (MetricsCollector, error) {
+	switch backend {
+	case "docker":
+		return &dockerCollector{docker: docker, cgroupRoot: cgroupRoot, procRoot: procRoot}, nil
+	case "cgroup":
+		return NewCgroupCollector(cgroupRoot, procRoot), nil
+	default:
+		return nil, fmt.Errorf("unknown container metrics backend %q", backend)
+	}
+}
+
+// dockerCollector reads metrics from the Docker Engine stats endpoint. The
+// stats endpoint has no pressure stall information nor open file counts, so
+// those are read from the cgroup filesystem when it is mounted; PSI only on
+// the unified v2 hierarchy.
+type dockerCollector struct {
+	docker     *DockerClient
+	cgroupRoot string
+	procRoot   string
+	cgroups    cgroupPaths
+}
+
+func (dc *dockerCollector) Collect(containers []DockerContainer, pids map[string]int) []*database.ContainerMetric {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		metrics []*database.ContainerMetric
+	)
+
+	unified := isUnifiedCgroup(dc.cgroupRoot)
+	discoveryRoot := cgroupDiscoveryRoot(dc.cgroupRoot, unified)
+	cgroups, _ := dc.cgroups.lookup(discoveryRoot, containers, pids)
+
+	// Each stats call blocks until the daemon has two CPU samples, so query
+	// the containers concurrently instead of one after another
+	for _, container := range containers {
+		wg.Add(1)
+		go func(container DockerContainer) {
+			defer wg.Done()
+
+			stats, err := dc.docker.ContainerStats(container.ID)
+			if err != nil {
+				log.Printf("Error getting stats for %s: %v", containerName(container), err)
+				return
+			}
+
+			metric := processContainerMetrics(container, stats)
+			if rel, ok := cgroups[container.ID]; ok {
+				dir := filepath.Join(discoveryRoot, rel)
+				metric.Processes, metric.FDs = readProcesses(filepath.Join(dir, "cgroup.procs"), dc.procRoot)
+				if unified {
+					metric.Pressure = readCgroupPressure(dir)
+				}
+			}
+
+			mu.Lock()
+			metrics = append(metrics, metric)
+			mu.Unlock()
+		}(container)
+	}
+	wg.Wait()
+
+	return metrics
+}
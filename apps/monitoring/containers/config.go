@@ -1,47 +1,60 @@
 package containers
 
 import (
+	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/mauriciogm/dokploy/apps/monitoring/config"
 )
 
-var monitorConfig *MonitoringConfig
+// monitorConfig is swapped as a whole when the configuration is reloaded
+var monitorConfig atomic.Pointer[MonitoringConfig]
+
+// Swarm names task containers <service>.<slot>.<taskID>
+var swarmTaskPattern = regexp.MustCompile(`^(.+)\.(\d+)\.[0-9a-z]+$`)
 
 func LoadConfig() error {
 	cfg := config.GetMetricsConfig()
-	monitorConfig = &MonitoringConfig{
-		IncludeServices: make([]string, len(cfg.Containers.Services.Include)),
-		ExcludeServices: make([]string, len(cfg.Containers.Services.Exclude)),
-	}
 
-	// Convert Include services
-	for i, svc := range cfg.Containers.Services.Include {
-		monitorConfig.IncludeServices[i] = svc
+	include, err := parseServiceSelectors(cfg.Containers.Services.Include)
+	if err != nil {
+		return fmt.Errorf("invalid include list: %v", err)
 	}
 
-	// Convert Exclude services
-	for i, appName := range cfg.Containers.Services.Exclude {
-		monitorConfig.ExcludeServices[i] = appName
+	exclude, err := parseServiceSelectors(cfg.Containers.Services.Exclude)
+	if err != nil {
+		return fmt.Errorf("invalid exclude list: %v", err)
 	}
 
+	monitorConfig.Store(&MonitoringConfig{
+		IncludeServices: include,
+		ExcludeServices: exclude,
+	})
+
 	return nil
 }
 
-func ShouldMonitorContainer(containerName string) bool {
-	if monitorConfig == nil {
+// ShouldMonitorContainer applies the exclude list first, so an excluded
+// container is never monitored even if it also matches the include list.
+// With an empty include list every remaining container is monitored.
+func ShouldMonitorContainer(container DockerContainer) bool {
+	current := monitorConfig.Load()
+	if current == nil {
 		return false
 	}
 
-	for _, excluded := range monitorConfig.ExcludeServices {
-		if strings.Contains(containerName, excluded) {
+	for _, excluded := range current.ExcludeServices {
+		if excluded.Matches(container) {
 			return false
 		}
 	}
 
-	if len(monitorConfig.IncludeServices) > 0 {
-		for _, included := range monitorConfig.IncludeServices {
-			if strings.Contains(containerName, included) {
+	if len(current.IncludeServices) > 0 {
+		for _, included := range current.IncludeServices {
+			if included.Matches(container) {
 				return true
 			}
 		}
@@ -51,11 +64,23 @@ func ShouldMonitorContainer(containerName string) bool {
 	return true
 }
 
-func GetServiceName(containerName string) string {
+// GetReplica guesses the service a container belongs to and its replica
+// slot from its name. It is only used when the container has no Swarm or
+// Compose labels: Swarm tasks carry the slot in their name, Compose
+// containers use a numeric suffix; standalone containers report slot 0.
+func GetReplica(containerName string) (string, int) {
 	name := strings.TrimPrefix(containerName, "/")
-	parts := strings.Split(name, "-")
-	if len(parts) > 1 {
-		return strings.Join(parts[:len(parts)-1], "-")
+
+	if match := swarmTaskPattern.FindStringSubmatch(name); match != nil {
+		slot, _ := strconv.Atoi(match[2])
+		return match[1], slot
 	}
-	return name
+
+	if i := strings.LastIndex(name, "-"); i > 0 {
+		if slot, err := strconv.Atoi(name[i+1:]); err == nil {
+			return name[:i], slot
+		}
+	}
+
+	return name, 0
 }
@@ -0,0 +1,277 @@
+package containers
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mauriciogm/dokploy/apps/monitoring/config"
+	"github.com/mauriciogm/dokploy/apps/monitoring/database"
+)
+
+// DiskUsageMonitor periodically records the space used by images, container
+// writable layers, volumes and the build cache, like `docker system df -v`.
+// It covers every container of the host, not only the monitored services.
+type DiskUsageMonitor struct {
+	db   *database.DB
+	mu   sync.Mutex
+	stop context.CancelFunc
+	done chan struct{} // closed when the collection goroutine exits
+}
+
+func NewDiskUsageMonitor(db *database.DB) *DiskUsageMonitor {
+	return &DiskUsageMonitor{db: db}
+}
+
+// Start collects once right away, since the refresh rate is usually hours,
+// and then every containers.diskUsage.refreshRate seconds
+func (dm *DiskUsageMonitor) Start() {
+	metricsConfig := config.GetMetricsConfig()
+	refreshRate := metricsConfig.Containers.DiskUsage.RefreshRate
+	if refreshRate == 0 {
+		log.Printf("Docker disk usage collection is disabled")
+		return
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	dm.mu.Lock()
+	dm.stop = stop
+	dm.done = done
+	dm.mu.Unlock()
+
+	docker := NewDockerClient(metricsConfig.Containers.DockerSocket)
+	duration := time.Duration(refreshRate) * time.Second
+	log.Printf("Refreshing Docker disk usage every %v", duration)
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(duration)
+		defer ticker.Stop()
+
+		for {
+			dm.collect(ctx, docker)
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop waits for a collection in progress to end
+func (dm *DiskUsageMonitor) Stop() {
+	dm.mu.Lock()
+	stop, done := dm.stop, dm.done
+	dm.stop, dm.done = nil, nil
+	dm.mu.Unlock()
+
+	if stop != nil {
+		stop()
+		<-done
+	}
+}
+
+// Restart picks up a new refresh rate or Docker socket
+func (dm *DiskUsageMonitor) Restart() {
+	dm.Stop()
+	dm.Start()
+}
+
+func (dm *DiskUsageMonitor) collect(ctx context.Context, docker *DockerClient) {
+	usage, err := docker.DiskUsage(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Error getting Docker disk usage: %v", err)
+		}
+		return
+	}
+
+	timestamp := time.Now().UTC().Format(time.RFC3339Nano)
+	totals, items := diskUsageMetrics(usage, timestamp)
+	if err := dm.db.SaveDockerDiskUsage(totals, items); err != nil {
+		log.Printf("Error saving Docker disk usage: %v", err)
+	}
+}
+
+// diskUsageMetrics computes the totals the way the docker CLI does and ties
+// every image and volume to the services of the containers using it
+func diskUsageMetrics(usage *DockerDiskUsage, timestamp string) ([]database.DockerDiskUsage, []database.DockerDiskItem) {
+	images := database.DockerDiskUsage{Timestamp: timestamp, Type: database.DockerDiskImages, Count: len(usage.Images), Size: size(usage.LayersSize)}
+	containers := database.DockerDiskUsage{Timestamp: timestamp, Type: database.DockerDiskContainers, Count: len(usage.Containers)}
+	volumes := database.DockerDiskUsage{Timestamp: timestamp, Type: database.DockerDiskVolumes, Count: len(usage.Volumes)}
+	buildCache := database.DockerDiskUsage{Timestamp: timestamp, Type: database.DockerDiskBuildCache, Count: len(usage.BuildCache)}
+
+	var items []database.DockerDiskItem
+	imageUsers := make(map[string]*owners)
+	volumeUsers := make(map[string]*owners)
+
+	for _, container := range usage.Containers {
+		metric := &database.ContainerMetric{Name: containerName(container.DockerContainer)}
+		applyContainerLabels(metric, container.Labels)
+
+		user := ownersOf(imageUsers, container.ImageID)
+		user.add(metric.Service, metric.Project())
+		for _, mount := range container.Mounts {
+			if mount.Type == "volume" {
+				ownersOf(volumeUsers, mount.Name).add(metric.Service, metric.Project())
+			}
+		}
+
+		item := database.DockerDiskItem{
+			Timestamp: timestamp,
+			ID:        container.ID,
+			Type:      database.DockerDiskContainers,
+			Name:      metric.Name,
+			Size:      size(container.SizeRw),
+			Services:  nonEmpty(metric.Service),
+			Projects:  nonEmpty(metric.Project()),
+		}
+		containers.Size += item.Size
+		if container.State == "running" {
+			containers.Active++
+		} else {
+			item.Reclaimable = item.Size
+			containers.Reclaimable += item.Size
+		}
+		items = append(items, item)
+	}
+
+	// Layers shared between images are counted once in LayersSize, so what
+	// is reclaimable is everything but the unique size of images in use
+	var used uint64
+	for _, image := range usage.Images {
+		item := database.DockerDiskItem{
+			Timestamp:  timestamp,
+			ID:         image.ID,
+			Type:       database.DockerDiskImages,
+			Name:       imageName(image),
+			Size:       size(image.Size),
+			Shared:     size(image.SharedSize),
+			Containers: int(image.Containers),
+		}
+		unique := item.Size - item.Shared
+		if item.Shared > item.Size {
+			unique = 0
+		}
+		if image.Containers > 0 {
+			images.Active++
+			used += unique
+		} else {
+			item.Reclaimable = unique
+		}
+		if user, ok := imageUsers[image.ID]; ok {
+			item.Services, item.Projects = user.lists()
+		}
+		items = append(items, item)
+	}
+	if used < images.Size {
+		images.Reclaimable = images.Size - used
+	}
+
+	for _, volume := range usage.Volumes {
+		item := database.DockerDiskItem{
+			Timestamp: timestamp,
+			ID:        volume.Name,
+			Type:      database.DockerDiskVolumes,
+			Name:      volume.Name,
+		}
+		if volume.UsageData != nil {
+			item.Size = size(volume.UsageData.Size)
+			item.Containers = int(size(volume.UsageData.RefCount))
+		}
+
+		// Volumes without containers still carry the project that created them
+		user := ownersOf(volumeUsers, volume.Name)
+		user.add("", volume.Labels[labelComposeProject])
+		user.add("", volume.Labels[labelStackNamespace])
+		item.Services, item.Projects = user.lists()
+
+		volumes.Size += item.Size
+		if item.Containers > 0 {
+			volumes.Active++
+		} else {
+			item.Reclaimable = item.Size
+			volumes.Reclaimable += item.Size
+		}
+		items = append(items, item)
+	}
+
+	for _, record := range usage.BuildCache {
+		if record.InUse {
+			buildCache.Active++
+		}
+		if record.Shared {
+			continue
+		}
+		buildCache.Size += size(record.Size)
+		if !record.InUse {
+			buildCache.Reclaimable += size(record.Size)
+		}
+	}
+
+	return []database.DockerDiskUsage{images, containers, volumes, buildCache}, items
+}
+
+// owners collects the services and projects using an image or a volume
+type owners struct {
+	services map[string]bool
+	projects map[string]bool
+}
+
+func ownersOf(byID map[string]*owners, id string) *owners {
+	if byID[id] == nil {
+		byID[id] = &owners{services: make(map[string]bool), projects: make(map[string]bool)}
+	}
+	return byID[id]
+}
+
+func (o *owners) add(service, project string) {
+	if service != "" {
+		o.services[service] = true
+	}
+	if project != "" {
+		o.projects[project] = true
+	}
+}
+
+func (o *owners) lists() (services, projects database.StringList) {
+	return sortedKeys(o.services), sortedKeys(o.projects)
+}
+
+func sortedKeys(set map[string]bool) database.StringList {
+	keys := database.StringList{}
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func nonEmpty(value string) database.StringList {
+	if value == "" {
+		return database.StringList{}
+	}
+	return database.StringList{value}
+}
+
+func imageName(image DiskUsageImage) string {
+	for _, tag := range image.RepoTags {
+		if tag != "<none>:<none>" {
+			return tag
+		}
+	}
+	return "<none>"
+}
+
+// size treats the -1 the daemon reports for sizes and reference counts it did
+// not compute as 0
+func size(value int64) uint64 {
+	if value < 0 {
+		return 0
+	}
+	return uint64(value)
+}
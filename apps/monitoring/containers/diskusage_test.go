@@ -0,0 +1,109 @@
+package containers
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/mauriciogm/dokploy/apps/monitoring/database"
+)
+
+// systemDF is a /system/df response: two images sharing layers, a running
+// Compose container and a stopped Swarm task of the same image, a volume in
+// use, an orphaned one and one whose size was not computed
+const systemDF = `{
+	"LayersSize": 1000,
+	"Images": [
+		{"Id": "sha256:img1", "RepoTags": ["nginx:latest"], "Size": 600, "SharedSize": 200, "Containers": 2},
+		{"Id": "sha256:img2", "RepoTags": ["<none>:<none>"], "Size": 500, "SharedSize": 200, "Containers": 0}
+	],
+	"Containers": [
+		{
+			"Id": "c1", "Names": ["/shop-web-1"], "State": "running", "ImageID": "sha256:img1", "SizeRw": 50,
+			"Labels": {"com.docker.compose.project": "shop", "com.docker.compose.service": "web"},
+			"Mounts": [{"Type": "volume", "Name": "shop_data"}, {"Type": "bind", "Name": ""}]
+		},
+		{
+			"Id": "c2", "Names": ["/blog_api.1.x2k9"], "State": "exited", "ImageID": "sha256:img1", "SizeRw": 30,
+			"Labels": {"com.docker.swarm.service.name": "blog_api", "com.docker.stack.namespace": "blog"}
+		}
+	],
+	"Volumes": [
+		{"Name": "shop_data", "UsageData": {"Size": 300, "RefCount": 1}},
+		{"Name": "legacy_data", "Labels": {"com.docker.compose.project": "legacy"}, "UsageData": {"Size": 100, "RefCount": 0}},
+		{"Name": "pending", "UsageData": {"Size": -1, "RefCount": -1}}
+	],
+	"BuildCache": [
+		{"ID": "b1", "Size": 40, "InUse": true},
+		{"ID": "b2", "Size": 60},
+		{"ID": "b3", "Size": 500, "Shared": true}
+	]
+}`
+
+func TestDiskUsageMetrics(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/system/df", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(systemDF))
+	})
+	docker := newFakeDocker(t, mux)
+
+	usage, err := docker.DiskUsage(context.Background())
+	if err != nil {
+		t.Fatalf("DiskUsage: %v", err)
+	}
+	const timestamp = "2024-01-01T00:00:00Z"
+	totals, items := diskUsageMetrics(usage, timestamp)
+
+	wantTotals := []database.DockerDiskUsage{
+		// Only the unique size of the image in use is not reclaimable
+		{Timestamp: timestamp, Type: database.DockerDiskImages, Count: 2, Active: 1, Size: 1000, Reclaimable: 600},
+		{Timestamp: timestamp, Type: database.DockerDiskContainers, Count: 2, Active: 1, Size: 80, Reclaimable: 30},
+		{Timestamp: timestamp, Type: database.DockerDiskVolumes, Count: 3, Active: 1, Size: 400, Reclaimable: 100},
+		// Shared records are not counted
+		{Timestamp: timestamp, Type: database.DockerDiskBuildCache, Count: 3, Active: 1, Size: 100, Reclaimable: 60},
+	}
+	if !reflect.DeepEqual(totals, wantTotals) {
+		t.Errorf("got totals %+v, want %+v", totals, wantTotals)
+	}
+
+	wantItems := map[string]database.DockerDiskItem{
+		"c1": {Type: database.DockerDiskContainers, Name: "shop-web-1", Size: 50,
+			Services: database.StringList{"web"}, Projects: database.StringList{"shop"}},
+		"c2": {Type: database.DockerDiskContainers, Name: "blog_api.1.x2k9", Size: 30, Reclaimable: 30,
+			Services: database.StringList{"blog_api"}, Projects: database.StringList{"blog"}},
+		"sha256:img1": {Type: database.DockerDiskImages, Name: "nginx:latest", Size: 600, Shared: 200, Containers: 2,
+			Services: database.StringList{"blog_api", "web"}, Projects: database.StringList{"blog", "shop"}},
+		"sha256:img2": {Type: database.DockerDiskImages, Name: "<none>", Size: 500, Shared: 200, Reclaimable: 300},
+		"shop_data": {Type: database.DockerDiskVolumes, Name: "shop_data", Size: 300, Containers: 1,
+			Services: database.StringList{"web"}, Projects: database.StringList{"shop"}},
+		// An orphaned volume keeps the project that created it
+		"legacy_data": {Type: database.DockerDiskVolumes, Name: "legacy_data", Size: 100, Reclaimable: 100,
+			Projects: database.StringList{"legacy"}},
+		"pending": {Type: database.DockerDiskVolumes, Name: "pending"},
+	}
+	if len(items) != len(wantItems) {
+		t.Fatalf("got %d items, want %d", len(items), len(wantItems))
+	}
+	for _, item := range items {
+		want, ok := wantItems[item.ID]
+		if !ok {
+			t.Errorf("unexpected item %s", item.ID)
+			continue
+		}
+		want.Timestamp, want.ID = timestamp, item.ID
+		// A nil list is stored as an empty one
+		for _, normalized := range []*database.DockerDiskItem{&item, &want} {
+			if normalized.Services == nil {
+				normalized.Services = database.StringList{}
+			}
+			if normalized.Projects == nil {
+				normalized.Projects = database.StringList{}
+			}
+		}
+		if !reflect.DeepEqual(item, want) {
+			t.Errorf("got %+v, want %+v", item, want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package containers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DockerClient talks to the Docker Engine API over its unix socket
+type DockerClient struct {
+	httpClient *http.Client
+
+	// streamClient has no timeout, for the event stream and disk usage
+	streamClient *http.Client
+}
+
+func NewDockerClient(socketPath string) *DockerClient {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		},
+	}
+
+	return &DockerClient{
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   30 * time.Second,
+		},
+		streamClient: &http.Client{Transport: transport},
+	}
+}
+
+func (d *DockerClient) get(path string, query url.Values, out interface{}) error {
+	return d.getWith(context.Background(), d.httpClient, path, query, out)
+}
+
+func (d *DockerClient) getWith(ctx context.Context, client *http.Client, path string, query url.Values, out interface{}) error {
+	u := url.URL{Scheme: "http", Host: "docker", Path: path, RawQuery: query.Encode()}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("docker request %s failed: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("docker request %s returned %s: %s", path, resp.Status, string(bodyBytes))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding docker response for %s: %v", path, err)
+	}
+	return nil
+}
+
+// ListContainers returns the running containers
+func (d *DockerClient) ListContainers() ([]DockerContainer, error) {
+	var containers []DockerContainer
+	if err := d.get("/containers/json", nil, &containers); err != nil {
+		return nil, err
+	}
+	return containers, nil
+}
+
+// InspectContainer returns the state of a container. With size the daemon
+// also computes the size of its filesystem, which is much slower.
+func (d *DockerClient) InspectContainer(id string, size bool) (*ContainerInspect, error) {
+	var inspect ContainerInspect
+	var query url.Values
+	if size {
+		query = url.Values{"size": []string{"true"}}
+	}
+	if err := d.get("/containers/"+id+"/json", query, &inspect); err != nil {
+		return nil, err
+	}
+	return &inspect, nil
+}
+
+// DiskUsage returns the space used by images, containers, volumes and the
+// build cache. Computing the size of every volume can take minutes on busy
+// hosts, so only ctx bounds the request.
+func (d *DockerClient) DiskUsage(ctx context.Context) (*DockerDiskUsage, error) {
+	var usage DockerDiskUsage
+	if err := d.getWith(ctx, d.streamClient, "/system/df", nil, &usage); err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// ContainerStats returns a single stats sample for a container. With
+// stream=false the daemon fills precpu_stats so the CPU delta can be computed.
+func (d *DockerClient) ContainerStats(id string) (*ContainerStats, error) {
+	var stats ContainerStats
+	query := url.Values{"stream": []string{"false"}}
+	if err := d.get("/containers/"+id+"/stats", query, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// Events streams the container events that happened since the given time to
+// handle, until the stream fails or ctx is cancelled
+func (d *DockerClient) Events(ctx context.Context, since time.Time, handle func(DockerEvent)) error {
+	query := url.Values{
+		"since":   []string{fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond())},
+		"filters": []string{`{"type":["container"]}`},
+	}
+	u := url.URL{Scheme: "http", Host: "docker", Path: "/events", RawQuery: query.Encode()}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := d.streamClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("docker request /events failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("docker request /events returned %s: %s", resp.Status, string(bodyBytes))
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event DockerEvent
+		if err := decoder.Decode(&event); err != nil {
+			return fmt.Errorf("error decoding docker event: %v", err)
+		}
+		handle(event)
+	}
+}
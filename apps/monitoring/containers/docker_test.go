@@ -0,0 +1,161 @@
+package containers
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newFakeDocker serves the Docker Engine API on a unix socket and returns a
+// client connected to it
+func newFakeDocker(t *testing.T, handler http.Handler) *DockerClient {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listening on %s: %v", socket, err)
+	}
+
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+
+	return NewDockerClient(socket)
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		t.Errorf("encoding response: %v", err)
+	}
+}
+
+var testContainer = DockerContainer{
+	ID:    strings.Repeat("a", 64),
+	Names: []string{"/shop-api-1"},
+	Image: "nginx",
+	State: "running",
+	Labels: map[string]string{
+		"com.docker.compose.project": "shop",
+		"com.docker.compose.service": "api",
+	},
+}
+
+func testStats() *ContainerStats {
+	stats := &ContainerStats{ID: testContainer.ID, Name: "/shop-api-1"}
+	stats.CPUStats.CPUUsage.TotalUsage = 400000000
+	stats.CPUStats.SystemUsage = 2000000000
+	stats.CPUStats.OnlineCPUs = 2
+	stats.PreCPUStats.CPUUsage.TotalUsage = 200000000
+	stats.PreCPUStats.SystemUsage = 1000000000
+	stats.MemoryStats = MemoryStats{
+		Usage: 10485760,
+		Limit: 16777216,
+		Stats: map[string]uint64{"inactive_file": 2097152},
+	}
+	stats.Networks = map[string]NetworkStats{
+		"eth0": {RxBytes: 1000, TxBytes: 500},
+		"eth1": {RxBytes: 24, TxBytes: 6},
+	}
+	stats.BlkioStats.IoServiceBytesRecursive = []BlkioStatEntry{
+		{Major: 8, Op: "read", Value: 4096},
+		{Major: 8, Op: "Write", Value: 8192},
+		{Major: 8, Op: "total", Value: 12288},
+	}
+	stats.PidsStats = PidsStats{Current: 4, Limit: 100}
+	return stats
+}
+
+func fakeDockerHandler(t *testing.T) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, []DockerContainer{testContainer})
+	})
+	mux.HandleFunc("/containers/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/"+testContainer.ID+"/stats" {
+			http.Error(w, "No such container", http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("stream") != "false" {
+			t.Errorf("stats requested with stream=%q, want false", r.URL.Query().Get("stream"))
+		}
+		writeJSON(t, w, testStats())
+	})
+	return mux
+}
+
+func TestListContainers(t *testing.T) {
+	docker := newFakeDocker(t, fakeDockerHandler(t))
+
+	containers, err := docker.ListContainers()
+	if err != nil {
+		t.Fatalf("ListContainers: %v", err)
+	}
+	if len(containers) != 1 || containers[0].ID != testContainer.ID || containerName(containers[0]) != "shop-api-1" {
+		t.Errorf("got %+v", containers)
+	}
+}
+
+func TestContainerStatsError(t *testing.T) {
+	docker := newFakeDocker(t, fakeDockerHandler(t))
+
+	_, err := docker.ContainerStats("missing")
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("got %v, want a 404 error", err)
+	}
+}
+
+func TestDockerCollector(t *testing.T) {
+	docker := newFakeDocker(t, fakeDockerHandler(t))
+	collector := &dockerCollector{docker: docker, cgroupRoot: t.TempDir(), procRoot: t.TempDir()}
+
+	metrics := collector.Collect([]DockerContainer{testContainer}, nil)
+	if len(metrics) != 1 {
+		t.Fatalf("got %d metrics, want 1", len(metrics))
+	}
+	metric := metrics[0]
+
+	// 200ms of the 1s the host CPUs ran, on 2 CPUs
+	if metric.CPU != 40 {
+		t.Errorf("got CPU %v%%, want 40%%", metric.CPU)
+	}
+
+	// The inactive page cache is not counted, like docker stats
+	if metric.Memory.Used != 8388608 || metric.Memory.Total != 16777216 || metric.Memory.Percentage != 50 {
+		t.Errorf("got memory %+v, want 8388608/16777216 bytes (50%%)", metric.Memory)
+	}
+
+	// Every interface is summed
+	if metric.Network.Input != 1024 || metric.Network.Output != 506 ||
+		metric.Network.InputBytes != 1024 || metric.Network.OutputBytes != 506 {
+		t.Errorf("got network %+v, want 1024 bytes in and 506 out", metric.Network)
+	}
+
+	if metric.BlockIO.Read != 4096 || metric.BlockIO.Write != 8192 {
+		t.Errorf("got block IO %+v, want 4096 bytes read and 8192 written", metric.BlockIO)
+	}
+
+	if metric.Pids != 4 || metric.PidsLimit != 100 {
+		t.Errorf("got pids %d/%d, want 4/100", metric.Pids, metric.PidsLimit)
+	}
+	if metric.ID != "aaaaaaaaaaaa" || metric.Name != "shop-api-1" {
+		t.Errorf("got ID %q and name %q", metric.ID, metric.Name)
+	}
+}
+
+func TestDockerCollectorSkipsFailedStats(t *testing.T) {
+	docker := newFakeDocker(t, fakeDockerHandler(t))
+	collector := &dockerCollector{docker: docker, cgroupRoot: t.TempDir(), procRoot: t.TempDir()}
+
+	missing := DockerContainer{ID: strings.Repeat("f", 64), Names: []string{"/gone"}}
+	metrics := collector.Collect([]DockerContainer{testContainer, missing}, nil)
+	if len(metrics) != 1 || metrics[0].Name != "shop-api-1" {
+		t.Errorf("got %d metrics, want only shop-api-1", len(metrics))
+	}
+}
@@ -0,0 +1,97 @@
+package containers
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mauriciogm/dokploy/apps/monitoring/database"
+)
+
+// eventActions are the container events that are stored
+var eventActions = map[string]bool{
+	"start":         true,
+	"die":           true,
+	"oom":           true,
+	"kill":          true,
+	"health_status": true,
+	"restart":       true,
+}
+
+const eventsReconnectDelay = 5 * time.Second
+
+// watchEvents stores the lifecycle events of the monitored containers until
+// ctx is cancelled. The stream is reopened from the last event when the
+// daemon closes it or restarts.
+func (cm *ContainerMonitor) watchEvents(ctx context.Context, docker *DockerClient) {
+	since := time.Now()
+	for {
+		err := docker.Events(ctx, since, func(event DockerEvent) {
+			since = time.Unix(0, event.TimeNano+1)
+			// Any event may change what an inspect returns
+			cm.inspects.invalidate(event.Actor.ID)
+			if stored, ok := containerEvent(event); ok {
+				if err := cm.db.SaveContainerEvent(stored); err != nil {
+					log.Printf("Error saving %s event of %s: %v", stored.Action, stored.Name, err)
+				}
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Docker event stream closed, reconnecting in %v: %v", eventsReconnectDelay, err)
+
+		select {
+		case <-time.After(eventsReconnectDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// containerEvent converts a Docker event of a monitored container. ok is
+// false for other actions and for containers that are not monitored.
+func containerEvent(event DockerEvent) (*database.ContainerEvent, bool) {
+	// health_status events carry the status in the action itself
+	action, detail, _ := strings.Cut(event.Action, ":")
+	if event.Type != "container" || !eventActions[action] {
+		return nil, false
+	}
+
+	attributes := event.Actor.Attributes
+	container := DockerContainer{
+		ID:     event.Actor.ID,
+		Names:  []string{"/" + attributes["name"]},
+		Image:  attributes["image"],
+		Labels: attributes,
+	}
+	if !ShouldMonitorContainer(container) {
+		return nil, false
+	}
+
+	// Resolve the service like the metrics so both match the same appName
+	metric := &database.ContainerMetric{Name: containerName(container)}
+	applyContainerLabels(metric, attributes)
+
+	stored := &database.ContainerEvent{
+		Timestamp:   time.Unix(0, event.TimeNano).UTC().Format(time.RFC3339Nano),
+		ContainerID: shortID(event.Actor.ID),
+		Name:        metric.Name,
+		Service:     metric.Service,
+		Project:     metric.Project(),
+		Action:      action,
+	}
+	switch action {
+	case "die":
+		if code, err := strconv.Atoi(attributes["exitCode"]); err == nil {
+			stored.ExitCode = &code
+		}
+	case "kill":
+		stored.Signal = attributes["signal"]
+	case "health_status":
+		stored.Health = strings.TrimSpace(detail)
+	}
+	return stored, true
+}
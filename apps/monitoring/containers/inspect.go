@@ -0,0 +1,142 @@
+package containers
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// inspectMaxAge bounds how long an inspect is reused, in case an event was
+// missed while the stream was reconnecting
+const inspectMaxAge = 10 * time.Minute
+
+// inspectCache keeps the inspect of each container between collections, so
+// that the Docker API is not called for every container on every tick. The
+// state, restart count and limits only change along with a container event
+// (start, die, health_status, update...), which drops the entry; it is read
+// again on the next collection.
+type inspectCache struct {
+	mu      sync.Mutex
+	entries map[string]inspectEntry
+
+	// generation of each container, increased by every event so an inspect
+	// started before the event is not cached
+	generations map[string]uint64
+}
+
+type inspectEntry struct {
+	inspect    *ContainerInspect
+	at         time.Time
+	generation uint64
+}
+
+func newInspectCache() *inspectCache {
+	return &inspectCache{entries: make(map[string]inspectEntry), generations: make(map[string]uint64)}
+}
+
+func (ic *inspectCache) get(id string, now time.Time) (*ContainerInspect, bool) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	entry, ok := ic.entries[id]
+	if !ok || entry.generation != ic.generations[id] || now.Sub(entry.at) >= inspectMaxAge {
+		return nil, false
+	}
+	return entry.inspect, true
+}
+
+func (ic *inspectCache) generation(id string) uint64 {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	return ic.generations[id]
+}
+
+// put stores an inspect unless an event arrived since it was requested
+func (ic *inspectCache) put(id string, inspect *ContainerInspect, generation uint64, now time.Time) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	if generation == ic.generations[id] {
+		ic.entries[id] = inspectEntry{inspect: inspect, at: now, generation: generation}
+	}
+}
+
+// invalidate is called for every event of a container
+func (ic *inspectCache) invalidate(id string) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	ic.generations[id]++
+	delete(ic.entries, id)
+}
+
+// retain forgets the containers that are no longer monitored
+func (ic *inspectCache) retain(ids map[string]bool) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	for id := range ic.entries {
+		if !ids[id] {
+			delete(ic.entries, id)
+		}
+	}
+	for id := range ic.generations {
+		if !ids[id] {
+			delete(ic.generations, id)
+		}
+	}
+}
+
+// clear drops every entry, since events are not followed while the monitor
+// is stopped
+func (ic *inspectCache) clear() {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	for id := range ic.entries {
+		ic.generations[id]++
+	}
+	ic.entries = make(map[string]inspectEntry)
+}
+
+// inspectContainers returns the inspect of each container by full ID. Cached
+// ones are reused; the others, and those whose filesystem size is due, are
+// requested concurrently like the stats of dockerCollector.
+func (ic *inspectCache) inspectContainers(docker *DockerClient, ids []string, sized map[string]bool, now time.Time) map[string]*ContainerInspect {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		inspects = make(map[string]*ContainerInspect, len(ids))
+	)
+
+	for _, id := range ids {
+		if !sized[id] {
+			if inspect, ok := ic.get(id, now); ok {
+				mu.Lock()
+				inspects[id] = inspect
+				mu.Unlock()
+				continue
+			}
+		}
+
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+
+			generation := ic.generation(id)
+			inspect, err := docker.InspectContainer(id, sized[id])
+			if err != nil {
+				log.Printf("Error inspecting container %s: %v", shortID(id), err)
+				return
+			}
+			ic.put(id, inspect, generation, now)
+
+			mu.Lock()
+			inspects[id] = inspect
+			mu.Unlock()
+		}(id)
+	}
+	wg.Wait()
+
+	return inspects
+}
@@ -0,0 +1,60 @@
+package containers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mauriciogm/dokploy/apps/monitoring/database"
+)
+
+const (
+	labelSwarmService     = "com.docker.swarm.service.name"
+	labelSwarmTaskSlot    = "com.docker.swarm.task.slot"
+	labelSwarmTaskName    = "com.docker.swarm.task.name"
+	labelSwarmNodeID      = "com.docker.swarm.node.id"
+	labelStackNamespace   = "com.docker.stack.namespace"
+	labelComposeProject   = "com.docker.compose.project"
+	labelComposeService   = "com.docker.compose.service"
+	labelComposeContainer = "com.docker.compose.container-number"
+)
+
+// applyContainerLabels fills the orchestrator fields of a metric from the
+// container labels and derives its service name and replica slot. Names are
+// only parsed when the container has neither Swarm nor Compose labels.
+func applyContainerLabels(metric *database.ContainerMetric, labels map[string]string) {
+	metric.SwarmService = labels[labelSwarmService]
+	metric.SwarmNodeID = labels[labelSwarmNodeID]
+	metric.SwarmStack = labels[labelStackNamespace]
+	metric.SwarmTaskSlot = swarmTaskSlot(labels)
+	metric.ComposeProject = labels[labelComposeProject]
+	metric.ComposeService = labels[labelComposeService]
+
+	switch {
+	case metric.SwarmService != "":
+		metric.Service = metric.SwarmService
+		metric.Replica = metric.SwarmTaskSlot
+	case metric.ComposeService != "":
+		metric.Service = metric.ComposeService
+		metric.Replica, _ = strconv.Atoi(labels[labelComposeContainer])
+	default:
+		metric.Service, metric.Replica = GetReplica(metric.Name)
+	}
+}
+
+// swarmTaskSlot reads the slot label when present, otherwise it is taken from
+// the task name (<service>.<slot>.<taskID>). Global services have no slot.
+func swarmTaskSlot(labels map[string]string) int {
+	if slot, err := strconv.Atoi(labels[labelSwarmTaskSlot]); err == nil {
+		return slot
+	}
+
+	service := labels[labelSwarmService]
+	taskName := labels[labelSwarmTaskName]
+	if service == "" || !strings.HasPrefix(taskName, service+".") {
+		return 0
+	}
+
+	slot, _, _ := strings.Cut(strings.TrimPrefix(taskName, service+"."), ".")
+	n, _ := strconv.Atoi(slot)
+	return n
+}
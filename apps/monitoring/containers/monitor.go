@@ -1,71 +1,158 @@
 package containers
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"log"
-	"os/exec"
+	"math"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/shirou/gopsutil/v3/cpu"
+
 	"github.com/mauriciogm/dokploy/apps/monitoring/config"
 	"github.com/mauriciogm/dokploy/apps/monitoring/database"
 )
 
 type ContainerMonitor struct {
 	db        *database.DB
+	docker    *DockerClient
+	collector MetricsCollector
+	backend   collectorSettings
 	isRunning bool
 	mu        sync.Mutex
 	stopChan  chan struct{}
+	done      chan struct{} // closed when the collection and event goroutines exit
+
+	// stopEvents ends the Docker event stream
+	stopEvents context.CancelFunc
+
+	// previous counters per container, to compute rates
+	previous map[string]containerSample
+
+	inspects *inspectCache
+}
+
+type containerSample struct {
+	network    database.NetworkMetric
+	throttling *database.ContainerThrottling
+	at         time.Time
+
+	// last filesystem size, repeated until the next one is due
+	filesystem   *database.ContainerFilesystem
+	filesystemAt time.Time
+}
+
+// collectorSettings are the options the collector is built from, kept to
+// know whether a reload has to replace it
+type collectorSettings struct {
+	dockerSocket string
+	backend      string
+	cgroupRoot   string
+	procRoot     string
 }
 
 func NewContainerMonitor(db *database.DB) (*ContainerMonitor, error) {
 	if err := db.InitContainerMetricsTable(); err != nil {
 		return nil, fmt.Errorf("failed to initialize container metrics table: %v", err)
 	}
+	if err := db.InitContainerEventsTable(); err != nil {
+		return nil, fmt.Errorf("failed to initialize container events table: %v", err)
+	}
 
-	return &ContainerMonitor{
-		db:       db,
-		stopChan: make(chan struct{}),
-	}, nil
+	cm := &ContainerMonitor{db: db, previous: make(map[string]containerSample), inspects: newInspectCache()}
+	if err := cm.configureCollector(); err != nil {
+		return nil, err
+	}
+	return cm, nil
 }
 
-func (cm *ContainerMonitor) Start() error {
-	if err := LoadConfig(); err != nil {
-		return fmt.Errorf("error loading config: %v", err)
+func (cm *ContainerMonitor) configureCollector() error {
+	metricsConfig := config.GetMetricsConfig()
+	settings := collectorSettings{
+		dockerSocket: metricsConfig.Containers.DockerSocket,
+		backend:      metricsConfig.Containers.Backend,
+		cgroupRoot:   metricsConfig.HostPath(metricsConfig.Containers.CgroupRoot),
+		procRoot:     metricsConfig.HostPath(metricsConfig.Server.ProcRoot),
 	}
 
-	// Check if there are services to monitor
-	if len(monitorConfig.IncludeServices) == 0 {
-		log.Printf("No services to monitor. Skipping container metrics collection")
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if cm.collector != nil && settings == cm.backend {
 		return nil
 	}
 
+	docker := NewDockerClient(settings.dockerSocket)
+	collector, err := newMetricsCollector(settings.backend, docker, settings.cgroupRoot, settings.procRoot)
+	if err != nil {
+		return err
+	}
+
+	cm.docker = docker
+	cm.collector = collector
+	cm.backend = settings
+	return nil
+}
+
+// Start follows the Docker events and collects the metrics of the monitored
+// services. Events are recorded even when the include list is empty and no
+// metrics are collected.
+func (cm *ContainerMonitor) Start() error {
+	if err := LoadConfig(); err != nil {
+		return fmt.Errorf("error loading config: %v", err)
+	}
+
 	metricsConfig := config.GetMetricsConfig()
 	refreshRate := metricsConfig.Containers.RefreshRate
-	if refreshRate == 0 {
-		refreshRate = 60 // default refresh rate
-	}
 	duration := time.Duration(refreshRate) * time.Second
 
-	// log.Printf("Container metrics collection will run every %d seconds for services: %v", refreshRate, monitorConfig.IncludeServices)
+	stopChan := make(chan struct{})
+	done := make(chan struct{})
+	eventsCtx, stopEvents := context.WithCancel(context.Background())
+	cm.mu.Lock()
+	cm.stopChan = stopChan
+	cm.done = done
+	cm.stopEvents = stopEvents
+	docker := cm.docker
+	cm.mu.Unlock()
+
+	cm.inspects.clear()
+	eventsDone := make(chan struct{})
+	go func() {
+		defer close(eventsDone)
+		cm.watchEvents(eventsCtx, docker)
+	}()
+
+	collect := len(monitorConfig.Load().IncludeServices) > 0
+	if !collect {
+		log.Printf("No services to monitor. Skipping container metrics collection")
+	}
 
 	ticker := time.NewTicker(duration)
 	go func() {
+		defer func() {
+			ticker.Stop()
+			stopEvents()
+			<-eventsDone
+			close(done)
+		}()
 		for {
 			select {
 			case <-ticker.C:
+				if !collect {
+					continue
+				}
 				// Check again in case the configuration has changed
-				if len(monitorConfig.IncludeServices) == 0 {
+				if len(monitorConfig.Load().IncludeServices) == 0 {
 					log.Printf("No services to monitor. Stopping metrics collection")
-					ticker.Stop()
-					return
+					collect = false
+					continue
 				}
 				cm.collectMetrics()
-			case <-cm.stopChan:
-				ticker.Stop()
+			case <-stopChan:
 				return
 			}
 		}
@@ -74,8 +161,37 @@ func (cm *ContainerMonitor) Start() error {
 	return nil
 }
 
+// Stop waits for a collection in progress and for the event stream to
+// close, so a reloaded monitor never runs next to the previous one
 func (cm *ContainerMonitor) Stop() {
-	close(cm.stopChan)
+	cm.mu.Lock()
+	stopChan, done, stopEvents := cm.stopChan, cm.done, cm.stopEvents
+	cm.stopChan, cm.done, cm.stopEvents = nil, nil, nil
+	cm.mu.Unlock()
+
+	if stopEvents != nil {
+		stopEvents()
+	}
+	if stopChan != nil {
+		close(stopChan)
+		<-done
+	}
+}
+
+// Reload applies the current configuration: the selectors and refresh rate
+// are reloaded and the collector is only rebuilt when its settings changed,
+// so the cgroup backend keeps its previous CPU samples.
+func (cm *ContainerMonitor) Reload() error {
+	// Validate the new selectors before stopping the running collection
+	if err := LoadConfig(); err != nil {
+		return fmt.Errorf("error loading config: %v", err)
+	}
+	if err := cm.configureCollector(); err != nil {
+		return err
+	}
+
+	cm.Stop()
+	return cm.Start()
 }
 
 func (cm *ContainerMonitor) collectMetrics() {
@@ -94,177 +210,313 @@ func (cm *ContainerMonitor) collectMetrics() {
 		cm.mu.Unlock()
 	}()
 
-	cmd := exec.Command("docker", "stats", "--no-stream", "--format",
-		`{"BlockIO":"{{.BlockIO}}","CPUPerc":"{{.CPUPerc}}","ID":"{{.ID}}","MemPerc":"{{.MemPerc}}","MemUsage":"{{.MemUsage}}","Name":"{{.Name}}","NetIO":"{{.NetIO}}"}`)
-
-	output, err := cmd.CombinedOutput()
+	cm.mu.Lock()
+	docker, collector := cm.docker, cm.collector
+	cm.mu.Unlock()
 
-	// log.Printf("Output: %s", string(output))
+	dockerContainers, err := docker.ListContainers()
 	if err != nil {
-		log.Printf("Error getting docker stats: %v", err)
+		log.Printf("Error listing containers: %v", err)
 		return
 	}
 
-	lines := string(output)
-	if lines == "" {
-		return
-	}
-
-	seenServices := make(map[string]bool)
-	for _, line := range strings.Split(lines, "\n") {
-		if line == "" {
+	var selected []DockerContainer
+	for _, container := range dockerContainers {
+		if !ShouldMonitorContainer(container) {
 			continue
 		}
+		selected = append(selected, container)
+	}
 
-		var container Container
-		if err := json.Unmarshal([]byte(line), &container); err != nil {
-			log.Printf("Error parsing container data: %v", err)
-			continue
+	// All replicas of a collection share the same timestamp so they can be
+	// grouped back into a service-level sample
+	now := time.Now()
+	timestamp := now.UTC().Format(time.RFC3339Nano)
+
+	labels := make(map[string]map[string]string, len(selected))
+	ids := make(map[string]string, len(selected))
+	for _, container := range selected {
+		labels[shortID(container.ID)] = container.Labels
+		ids[shortID(container.ID)] = container.ID
+	}
+
+	var hostCPUs int
+	if counts, err := cpu.Counts(true); err == nil {
+		hostCPUs = counts
+	}
+	filesystemRate := time.Duration(config.GetMetricsConfig().Containers.Filesystem.RefreshRate) * time.Second
+
+	// The filesystem size needs a fresh inspect; the rest comes from the
+	// cache while no event reported a change. The inspect is taken before
+	// the collection, which reads the network of the container init process.
+	inspectIDs := make([]string, 0, len(selected))
+	sized := make(map[string]bool)
+	for _, container := range selected {
+		inspectIDs = append(inspectIDs, container.ID)
+		if filesystemRate > 0 && now.Sub(cm.previous[shortID(container.ID)].filesystemAt) >= filesystemRate {
+			sized[container.ID] = true
 		}
+	}
+	inspects := cm.inspects.inspectContainers(docker, inspectIDs, sized, now)
 
-		if !ShouldMonitorContainer(container.Name) {
-			continue
+	pids := make(map[string]int, len(inspects))
+	for id, inspect := range inspects {
+		pids[id] = inspect.State.Pid
+	}
+	metrics := collector.Collect(selected, pids)
+
+	seen := make(map[string]bool)
+	for _, metric := range metrics {
+		metric.Timestamp = timestamp
+		applyContainerLabels(metric, labels[metric.ID])
+		if metric.PidsLimit > 0 {
+			metric.PidsPercent = round2(float64(metric.Pids) / float64(metric.PidsLimit) * 100)
 		}
 
-		serviceName := GetServiceName(container.Name)
+		prev, hasPrev := cm.previous[metric.ID]
+		sample := containerSample{network: metric.Network, throttling: metric.Throttling, at: now}
+		if filesystemRate > 0 {
+			sample.filesystem, sample.filesystemAt = prev.filesystem, prev.filesystemAt
+		}
+		sizeDue := sized[ids[metric.ID]]
 
-		if seenServices[serviceName] {
-			continue
+		if inspect, ok := inspects[ids[metric.ID]]; ok {
+			metric.State = containerState(inspect, now)
+			metric.Limits = containerLimits(inspect, metric, hostCPUs)
+			if sizeDue {
+				sample.filesystem, sample.filesystemAt = containerFilesystem(inspect, timestamp), now
+			}
 		}
+		metric.Filesystem = sample.filesystem
 
-		seenServices[serviceName] = true
+		if hasPrev {
+			metric.Network.SetRates(prev.network, now.Sub(prev.at))
+			if metric.Throttling != nil && prev.throttling != nil {
+				metric.Throttling.SetPercent(*prev.throttling)
+			}
+		}
+		cm.previous[metric.ID] = sample
+		seen[metric.ID] = true
 
-		// log.Printf("Container: %+v", container)
+		if err := cm.db.SaveContainerMetric(metric); err != nil {
+			log.Printf("Error saving metrics for %s: %v", metric.Name, err)
+		}
+	}
 
-		// Process metrics
-		metric := processContainerMetrics(container)
+	for id := range cm.previous {
+		if !seen[id] {
+			delete(cm.previous, id)
+		}
+	}
 
-		// log.Printf("Saving metrics for %s: %+v", serviceName, metric)
+	monitored := make(map[string]bool, len(selected))
+	for _, container := range selected {
+		monitored[container.ID] = true
+	}
+	cm.inspects.retain(monitored)
+}
 
-		if err := cm.db.SaveContainerMetric(metric); err != nil {
-			log.Printf("Error saving metrics for %s: %v", serviceName, err)
-		}
+// containerState reads the state, health and restarts of a container
+func containerState(inspect *ContainerInspect, now time.Time) *database.ContainerState {
+	state := &database.ContainerState{
+		Status:       inspect.State.Status,
+		RestartCount: inspect.RestartCount,
+		ExitCode:     inspect.State.ExitCode,
+		OOMKilled:    inspect.State.OOMKilled,
+		StartedAt:    inspect.State.StartedAt,
+	}
+	if inspect.State.Health != nil {
+		state.Health = inspect.State.Health.Status
 	}
+	if startedAt, err := time.Parse(time.RFC3339Nano, inspect.State.StartedAt); err == nil && inspect.State.Status == "running" {
+		state.Uptime = int64(now.Sub(startedAt) / time.Second)
+	}
+	return state
 }
 
-func processContainerMetrics(container Container) *database.ContainerMetric {
+// containerFilesystem reads the sizes returned by an inspect with size. It
+// returns nil when the daemon did not compute them.
+func containerFilesystem(inspect *ContainerInspect, timestamp string) *database.ContainerFilesystem {
+	if inspect.SizeRw == nil && inspect.SizeRootFs == nil {
+		return nil
+	}
+	filesystem := &database.ContainerFilesystem{SampledAt: timestamp}
+	if inspect.SizeRw != nil {
+		filesystem.SizeRw = size(*inspect.SizeRw)
+	}
+	if inspect.SizeRootFs != nil {
+		filesystem.SizeRootFs = size(*inspect.SizeRootFs)
+	}
+	return filesystem
+}
 
-	// Process CPU
-	cpu, _ := strconv.ParseFloat(strings.TrimSuffix(container.CPUPerc, "%"), 64)
+// pidsLimit returns 0 for the values the stats endpoint reports for an
+// unlimited pids controller
+func pidsLimit(limit uint64) uint64 {
+	if limit >= math.MaxInt64 {
+		return 0
+	}
+	return limit
+}
 
-	// Process Memory
-	memPerc, _ := strconv.ParseFloat(strings.TrimSuffix(container.MemPerc, "%"), 64)
-	memParts := strings.Split(container.MemUsage, " / ")
-
-	var usedValue, totalValue float64
-	var usedUnit, totalUnit string
-
-	if len(memParts) == 2 {
-		// Process used memory
-		usedParts := strings.Fields(memParts[0])
-		if len(usedParts) > 0 {
-			usedValue, _ = strconv.ParseFloat(strings.TrimRight(usedParts[0], "MiBGiB"), 64)
-			usedUnit = strings.TrimLeft(usedParts[0], "0123456789.")
-			// Convert MiB to MB and GiB to GB
-			if usedUnit == "MiB" {
-				usedUnit = "MB"
-			} else if usedUnit == "GiB" {
-				usedUnit = "GB"
-			}
-		}
+// defaultCPUPeriod is the CFS period in microseconds when none is configured
+const defaultCPUPeriod = 100000
+
+// containerLimits reads the CPU and memory limits of a container and the
+// usage of the sample relative to them. Docker stores --cpus as NanoCpus and
+// writes it to the cgroup as a quota over the default 100ms period.
+func containerLimits(inspect *ContainerInspect, metric *database.ContainerMetric, hostCPUs int) *database.ContainerLimits {
+	host := inspect.HostConfig
+	limits := &database.ContainerLimits{
+		CPUQuota:          host.CPUQuota,
+		CPUPeriod:         host.CPUPeriod,
+		Cpuset:            host.CpusetCpus,
+		Memory:            host.Memory,
+		MemoryReservation: host.MemoryReservation,
+		CPUs:              float64(hostCPUs),
+	}
+	if limits.CPUPeriod == 0 {
+		limits.CPUPeriod = defaultCPUPeriod
+	}
+	if host.NanoCPUs > 0 {
+		limits.CPUQuota = host.NanoCPUs * limits.CPUPeriod / 1e9
+	}
 
-		// Process total memory
-		totalParts := strings.Fields(memParts[1])
-		if len(totalParts) > 0 {
-			totalValue, _ = strconv.ParseFloat(strings.TrimRight(totalParts[0], "MiBGiB"), 64)
-			totalUnit = strings.TrimLeft(totalParts[0], "0123456789.")
-			// Convert MiB to MB and GiB to GB
-			if totalUnit == "MiB" {
-				totalUnit = "MB"
-			} else if totalUnit == "GiB" {
-				totalUnit = "GB"
-			}
+	if cpus := cpusetSize(host.CpusetCpus); cpus > 0 && (limits.CPUs == 0 || float64(cpus) < limits.CPUs) {
+		limits.CPUs = float64(cpus)
+	}
+	if limits.CPUQuota > 0 {
+		if cpus := float64(limits.CPUQuota) / float64(limits.CPUPeriod); limits.CPUs == 0 || cpus < limits.CPUs {
+			limits.CPUs = round2(cpus)
 		}
 	}
 
-	// Process Network I/O
-	netParts := strings.Split(container.NetIO, " / ")
+	// CPU is on the docker stats scale of 100% per core
+	if limits.CPUs > 0 {
+		limits.CPUPercent = round2(metric.CPU / limits.CPUs)
+	}
+	// The collectors already compute memory against the cgroup limit, or
+	// against the host memory when there is none
+	limits.MemoryPercent = metric.Memory.Percentage
 
-	var netInValue, netOutValue float64
-	var netInUnit, netOutUnit string
+	return limits
+}
 
-	if len(netParts) == 2 {
-		// Process input
-		inParts := strings.Fields(netParts[0])
-		if len(inParts) > 0 {
-			netInValue, _ = strconv.ParseFloat(strings.TrimRight(inParts[0], "kMGTB"), 64)
-			netInUnit = strings.TrimLeft(inParts[0], "0123456789.")
+// cpusetSize counts the CPUs of a cpuset list such as "0-3,6". It returns 0
+// for an empty or invalid list.
+func cpusetSize(cpuset string) int {
+	count := 0
+	for _, part := range strings.Split(cpuset, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
 		}
-
-		// Process output
-		outParts := strings.Fields(netParts[1])
-		if len(outParts) > 0 {
-			netOutValue, _ = strconv.ParseFloat(strings.TrimRight(outParts[0], "kMGTB"), 64)
-			netOutUnit = strings.TrimLeft(outParts[0], "0123456789.")
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(first)
+		if err != nil {
+			return 0
 		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(last); err != nil || end < start {
+				return 0
+			}
+		}
+		count += end - start + 1
 	}
+	return count
+}
 
-	// Process Block I/O
-	blockParts := strings.Split(container.BlockIO, " / ")
-
-	var blockReadValue, blockWriteValue float64
-	var blockReadUnit, blockWriteUnit string
+func processContainerMetrics(container DockerContainer, stats *ContainerStats) *database.ContainerMetric {
+	// Process CPU
+	cpu := calculateCPUPercent(stats)
 
-	if len(blockParts) == 2 {
-		// Process read
-		readParts := strings.Fields(blockParts[0])
-		if len(readParts) > 0 {
-			blockReadValue, _ = strconv.ParseFloat(strings.TrimRight(readParts[0], "kMGTB"), 64)
-			blockReadUnit = strings.TrimLeft(readParts[0], "0123456789.")
-		}
+	// Process Memory
+	memUsed := calculateMemoryUsage(stats)
+	memLimit := stats.MemoryStats.Limit
+	// Process Network I/O
+	var netIn, netOut uint64
+	for _, network := range stats.Networks {
+		netIn += network.RxBytes
+		netOut += network.TxBytes
+	}
 
-		// Process write
-		writeParts := strings.Fields(blockParts[1])
-		if len(writeParts) > 0 {
-			blockWriteValue, _ = strconv.ParseFloat(strings.TrimRight(writeParts[0], "kMGTB"), 64)
-			blockWriteUnit = strings.TrimLeft(writeParts[0], "0123456789.")
+	// Process Block I/O
+	var blockRead, blockWrite uint64
+	for _, entry := range stats.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			blockRead += entry.Value
+		case "write":
+			blockWrite += entry.Value
 		}
 	}
 
+	id := shortID(container.ID)
+
 	return &database.ContainerMetric{
 		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
-		CPU:       cpu,
-		Memory: database.MemoryMetric{
-			Percentage: memPerc,
-			Used:       usedValue,
-			Total:      totalValue,
-			UsedUnit:   usedUnit,
-			TotalUnit:  totalUnit,
-		},
-		Network: database.NetworkMetric{
-			Input:      netInValue,
-			Output:     netOutValue,
-			InputUnit:  netInUnit,
-			OutputUnit: netOutUnit,
+		CPU:       round2(cpu),
+		Memory:    database.NewMemoryMetric(memUsed, memLimit),
+		Network:   database.NewNetworkMetric(netIn, netOut),
+		BlockIO:   database.NewBlockIOMetric(blockRead, blockWrite),
+		Pids:      stats.PidsStats.Current,
+		PidsLimit: pidsLimit(stats.PidsStats.Limit),
+		Throttling: &database.ContainerThrottling{
+			Periods:          stats.CPUStats.ThrottlingData.Periods,
+			ThrottledPeriods: stats.CPUStats.ThrottlingData.ThrottledPeriods,
+			ThrottledTime:    stats.CPUStats.ThrottlingData.ThrottledTime,
 		},
-		BlockIO: database.BlockIOMetric{
-			Read:      blockReadValue,
-			Write:     blockWriteValue,
-			ReadUnit:  blockReadUnit,
-			WriteUnit: blockWriteUnit,
-		},
-		Container: container.ID,
-		ID:        container.ID,
-		Name:      container.Name,
+		Container: id,
+		ID:        id,
+		Name:      containerName(container),
+	}
+}
+
+// calculateCPUPercent mirrors the docker CLI: the container's share of the
+// host CPU time between the two samples, scaled by the number of online CPUs
+func calculateCPUPercent(stats *ContainerStats) float64 {
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+
+	onlineCPUs := float64(stats.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+	return cpuDelta / systemDelta * onlineCPUs * 100
+}
+
+// calculateMemoryUsage excludes the page cache like `docker stats` does,
+// using total_inactive_file on cgroup v1 and inactive_file on cgroup v2
+func calculateMemoryUsage(stats *ContainerStats) uint64 {
+	usage := stats.MemoryStats.Usage
+	if v, ok := stats.MemoryStats.Stats["total_inactive_file"]; ok && v < usage {
+		return usage - v
+	}
+	if v, ok := stats.MemoryStats.Stats["inactive_file"]; ok && v < usage {
+		return usage - v
+	}
+	return usage
+}
+
+func containerName(container DockerContainer) string {
+	if len(container.Names) == 0 {
+		return shortID(container.ID)
 	}
+	return strings.TrimPrefix(container.Names[0], "/")
 }
 
-func parseValue(value string) (float64, string) {
-	parts := strings.Fields(value)
-	if len(parts) < 1 {
-		return 0, "B"
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
 	}
-	v, _ := strconv.ParseFloat(parts[0], 64)
-	unit := strings.TrimLeft(value, "0123456789.")
-	return v, unit
+	return id
+}
+
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
 }
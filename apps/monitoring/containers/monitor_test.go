@@ -0,0 +1,84 @@
+package containers
+
+import (
+	"testing"
+
+	"github.com/mauriciogm/dokploy/apps/monitoring/database"
+)
+
+func TestCpusetSize(t *testing.T) {
+	tests := []struct {
+		cpuset string
+		want   int
+	}{
+		{"", 0},
+		{"0", 1},
+		{"0-3", 4},
+		{"0-3,8", 5},
+		{"0,2,4", 3},
+		{" 0-1 , 6-7 ", 4},
+		{"0-3,", 4},
+		{"3-0", 0},
+		{"a-b", 0},
+		{"0-", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cpuset, func(t *testing.T) {
+			if got := cpusetSize(tt.cpuset); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerLimits(t *testing.T) {
+	const hostCPUs = 8
+
+	tests := []struct {
+		name       string
+		nanoCPUs   int64
+		quota      int64
+		period     int64
+		cpuset     string
+		wantQuota  int64
+		wantPeriod int64
+		wantCPUs   float64
+		wantCPUPct float64
+	}{
+		{name: "no limit", wantPeriod: 100000, wantCPUs: 8, wantCPUPct: 25},
+		// --cpus=1.5
+		{name: "nano CPUs", nanoCPUs: 1500000000, wantQuota: 150000, wantPeriod: 100000, wantCPUs: 1.5, wantCPUPct: 133.33},
+		{name: "nano CPUs with a period", nanoCPUs: 500000000, period: 50000, wantQuota: 25000, wantPeriod: 50000, wantCPUs: 0.5, wantCPUPct: 400},
+		{name: "quota", quota: 200000, period: 100000, wantQuota: 200000, wantPeriod: 100000, wantCPUs: 2, wantCPUPct: 100},
+		{name: "cpuset", cpuset: "0-3,8", wantPeriod: 100000, wantCPUs: 5, wantCPUPct: 40},
+		// The smallest of the quota and the cpuset applies
+		{name: "quota below the cpuset", nanoCPUs: 1000000000, cpuset: "0-3", wantQuota: 100000, wantPeriod: 100000, wantCPUs: 1, wantCPUPct: 200},
+		{name: "cpuset below the quota", nanoCPUs: 4000000000, cpuset: "0,1", wantQuota: 400000, wantPeriod: 100000, wantCPUs: 2, wantCPUPct: 100},
+		// A cpuset larger than the host does not raise the limit
+		{name: "cpuset beyond the host", cpuset: "0-15", wantPeriod: 100000, wantCPUs: 8, wantCPUPct: 25},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inspect ContainerInspect
+			inspect.HostConfig.NanoCPUs = tt.nanoCPUs
+			inspect.HostConfig.CPUQuota = tt.quota
+			inspect.HostConfig.CPUPeriod = tt.period
+			inspect.HostConfig.CpusetCpus = tt.cpuset
+			inspect.HostConfig.Memory = 1 << 30
+			metric := &database.ContainerMetric{CPU: 200, Memory: database.MemoryMetric{Percentage: 12.5}}
+
+			limits := containerLimits(&inspect, metric, hostCPUs)
+			if limits.CPUQuota != tt.wantQuota || limits.CPUPeriod != tt.wantPeriod {
+				t.Errorf("got quota %d/%d, want %d/%d", limits.CPUQuota, limits.CPUPeriod, tt.wantQuota, tt.wantPeriod)
+			}
+			if limits.CPUs != tt.wantCPUs || limits.CPUPercent != tt.wantCPUPct {
+				t.Errorf("got %v CPUs at %v%%, want %v at %v%%", limits.CPUs, limits.CPUPercent, tt.wantCPUs, tt.wantCPUPct)
+			}
+			if limits.Memory != 1<<30 || limits.MemoryPercent != 12.5 {
+				t.Errorf("got memory %d at %v%%", limits.Memory, limits.MemoryPercent)
+			}
+		})
+	}
+}
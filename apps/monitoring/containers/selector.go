@@ -0,0 +1,156 @@
+package containers
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/mauriciogm/dokploy/apps/monitoring/config"
+)
+
+func init() {
+	config.RegisterValidator(validateServiceSelectors)
+}
+
+type selectorKind int
+
+const (
+	selectorExact selectorKind = iota
+	selectorGlob
+	selectorRegex
+	selectorLabel
+)
+
+// ServiceSelector is one entry of the include/exclude lists. Entries are
+// recognised in this order:
+//
+//   - "regex:<expression>" matches a regular expression
+//   - "<label>=<value>" matches a Docker label; the value may be a glob
+//   - entries containing *, ? or [ are glob patterns
+//   - anything else must be equal to the name
+//
+// Exact, glob and regex entries are checked against the container name, its
+// Swarm service, and its Compose project or Swarm stack namespace.
+type ServiceSelector struct {
+	raw   string
+	kind  selectorKind
+	label string
+	value string
+	re    *regexp.Regexp
+}
+
+func ParseServiceSelector(raw string) (ServiceSelector, error) {
+	s := ServiceSelector{raw: raw, value: raw}
+
+	switch {
+	case raw == "":
+		return s, fmt.Errorf("empty service selector")
+	case strings.HasPrefix(raw, "regex:"):
+		re, err := regexp.Compile(strings.TrimPrefix(raw, "regex:"))
+		if err != nil {
+			return s, fmt.Errorf("invalid regex selector %q: %v", raw, err)
+		}
+		s.kind = selectorRegex
+		s.re = re
+	case strings.Contains(raw, "="):
+		label, value, _ := strings.Cut(raw, "=")
+		if label == "" {
+			return s, fmt.Errorf("invalid label selector %q: missing label name", raw)
+		}
+		if _, err := path.Match(value, ""); err != nil {
+			return s, fmt.Errorf("invalid label selector %q: %v", raw, err)
+		}
+		s.kind = selectorLabel
+		s.label = label
+		s.value = value
+	case strings.ContainsAny(raw, "*?["):
+		if _, err := path.Match(raw, ""); err != nil {
+			return s, fmt.Errorf("invalid glob selector %q: %v", raw, err)
+		}
+		s.kind = selectorGlob
+	default:
+		s.kind = selectorExact
+	}
+
+	return s, nil
+}
+
+func (s ServiceSelector) String() string {
+	return s.raw
+}
+
+func (s ServiceSelector) Matches(container DockerContainer) bool {
+	if s.kind == selectorLabel {
+		value, ok := container.Labels[s.label]
+		if !ok {
+			return false
+		}
+		matched, _ := path.Match(s.value, value)
+		return matched
+	}
+
+	for _, name := range selectableNames(container) {
+		if s.matchesName(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s ServiceSelector) matchesName(name string) bool {
+	switch s.kind {
+	case selectorRegex:
+		return s.re.MatchString(name)
+	case selectorGlob:
+		matched, _ := path.Match(s.value, name)
+		return matched
+	default:
+		return name == s.value
+	}
+}
+
+// selectableNames are the names a container can be selected by
+func selectableNames(container DockerContainer) []string {
+	names := []string{containerName(container)}
+	for _, label := range []string{labelSwarmService, labelComposeProject, labelStackNamespace} {
+		if value := container.Labels[label]; value != "" {
+			names = append(names, value)
+		}
+	}
+	return names
+}
+
+func parseServiceSelectors(entries []string) ([]ServiceSelector, error) {
+	selectors := make([]ServiceSelector, 0, len(entries))
+	for _, entry := range entries {
+		selector, err := ParseServiceSelector(entry)
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, selector)
+	}
+	return selectors, nil
+}
+
+func validateServiceSelectors(cfg *config.Config) config.ValidationErrors {
+	var errs config.ValidationErrors
+	lists := []struct {
+		path    string
+		entries []string
+	}{
+		{"containers.services.include", cfg.Containers.Services.Include},
+		{"containers.services.exclude", cfg.Containers.Services.Exclude},
+	}
+	for _, list := range lists {
+		for i, entry := range list.entries {
+			if _, err := ParseServiceSelector(entry); err != nil {
+				errs = append(errs, config.FieldError{
+					Path:    fmt.Sprintf("%s[%d]", list.path, i),
+					Message: err.Error(),
+				})
+			}
+		}
+	}
+	return errs
+}
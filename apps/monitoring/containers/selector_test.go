@@ -0,0 +1,184 @@
+package containers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mauriciogm/dokploy/apps/monitoring/config"
+)
+
+func TestParseServiceSelector(t *testing.T) {
+	tests := []struct {
+		raw     string
+		kind    selectorKind
+		wantErr string
+	}{
+		{raw: "shop-api", kind: selectorExact},
+		{raw: "shop-*", kind: selectorGlob},
+		{raw: "shop-?", kind: selectorGlob},
+		{raw: "regex:^shop-(api|web)$", kind: selectorRegex},
+		// A regex may contain glob characters and = signs
+		{raw: "regex:^a=[0-9]+$", kind: selectorRegex},
+		{raw: "com.docker.compose.project=shop", kind: selectorLabel},
+		{raw: "com.docker.compose.project=shop-*", kind: selectorLabel},
+		{raw: "", wantErr: "empty service selector"},
+		{raw: "regex:(", wantErr: "invalid regex selector"},
+		{raw: "=shop", wantErr: "missing label name"},
+		{raw: "env=[", wantErr: "invalid label selector"},
+		{raw: "shop-[", wantErr: "invalid glob selector"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			selector, err := ParseServiceSelector(tt.raw)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseServiceSelector: %v", err)
+			}
+			if selector.kind != tt.kind {
+				t.Errorf("got kind %d, want %d", selector.kind, tt.kind)
+			}
+		})
+	}
+}
+
+var (
+	composeContainer = DockerContainer{
+		Names: []string{"/shop-api-1"},
+		Labels: map[string]string{
+			labelComposeProject: "shop",
+			labelComposeService: "api",
+		},
+	}
+	swarmContainer = DockerContainer{
+		Names: []string{"/blog_web.1.x2k9"},
+		Labels: map[string]string{
+			labelSwarmService:   "blog_web",
+			labelStackNamespace: "blog",
+			"env":               "production",
+		},
+	}
+)
+
+func TestServiceSelectorMatches(t *testing.T) {
+	tests := []struct {
+		selector  string
+		container DockerContainer
+		want      bool
+	}{
+		// Exact entries match the name, Swarm service, project or stack
+		{"shop-api-1", composeContainer, true},
+		{"shop", composeContainer, true},
+		{"blog_web", swarmContainer, true},
+		{"blog", swarmContainer, true},
+		{"shop-api", composeContainer, false},
+		// The Compose service alone is not unique
+		{"api", composeContainer, false},
+
+		{"shop-*", composeContainer, true},
+		{"blog_*", swarmContainer, true},
+		{"*-web", swarmContainer, false},
+
+		{"regex:^shop-api-[0-9]+$", composeContainer, true},
+		{"regex:^blog$", swarmContainer, true},
+		{"regex:^web", swarmContainer, false},
+
+		{"env=production", swarmContainer, true},
+		{"env=prod*", swarmContainer, true},
+		{"env=staging", swarmContainer, false},
+		{"env=*", composeContainer, false},
+		{labelComposeService + "=api", composeContainer, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			selector, err := ParseServiceSelector(tt.selector)
+			if err != nil {
+				t.Fatalf("ParseServiceSelector: %v", err)
+			}
+			if got := selector.Matches(tt.container); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShouldMonitorContainer(t *testing.T) {
+	previous := monitorConfig.Load()
+	t.Cleanup(func() { monitorConfig.Store(previous) })
+
+	tests := []struct {
+		name      string
+		include   []string
+		exclude   []string
+		container DockerContainer
+		want      bool
+	}{
+		{name: "included", include: []string{"shop"}, container: composeContainer, want: true},
+		{name: "not included", include: []string{"shop"}, container: swarmContainer, want: false},
+		{name: "empty include list", container: swarmContainer, want: true},
+		{
+			name:      "exclude wins over include",
+			include:   []string{"shop-*"},
+			exclude:   []string{labelComposeService + "=api"},
+			container: composeContainer,
+			want:      false,
+		},
+		{
+			name:      "exclude without include list",
+			exclude:   []string{"regex:^blog"},
+			container: swarmContainer,
+			want:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			include, err := parseServiceSelectors(tt.include)
+			if err != nil {
+				t.Fatal(err)
+			}
+			exclude, err := parseServiceSelectors(tt.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			monitorConfig.Store(&MonitoringConfig{IncludeServices: include, ExcludeServices: exclude})
+
+			if got := ShouldMonitorContainer(tt.container); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Nothing is monitored before the configuration is loaded
+	monitorConfig.Store(nil)
+	if ShouldMonitorContainer(composeContainer) {
+		t.Error("container monitored without a configuration")
+	}
+}
+
+func TestValidateServiceSelectors(t *testing.T) {
+	var cfg config.Config
+	cfg.Containers.Services.Include = []string{"shop", "regex:(", "web-*"}
+	cfg.Containers.Services.Exclude = []string{"=production"}
+
+	// The validator is registered with the config package
+	var errs config.ValidationErrors
+	for _, fieldErr := range config.Validate(&cfg) {
+		if strings.HasPrefix(fieldErr.Path, "containers.services.") {
+			errs = append(errs, fieldErr)
+		}
+	}
+
+	if len(errs) != 2 {
+		t.Fatalf("got %v, want 2 errors", errs)
+	}
+	if errs[0].Path != "containers.services.include[1]" || errs[1].Path != "containers.services.exclude[0]" {
+		t.Errorf("got paths %q and %q", errs[0].Path, errs[1].Path)
+	}
+}
@@ -1,48 +1,158 @@
 package containers
 
-type Container struct {
-	BlockIO  string `json:"BlockIO"`
-	CPUPerc  string `json:"CPUPerc"`
-	ID       string `json:"ID"`
-	MemPerc  string `json:"MemPerc"`
-	MemUsage string `json:"MemUsage"`
-	Name     string `json:"Name"`
-	NetIO    string `json:"NetIO"`
+// DockerContainer is an entry of the Docker Engine API /containers/json response
+type DockerContainer struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Image  string            `json:"Image"`
+	State  string            `json:"State"`
+	Labels map[string]string `json:"Labels"`
 }
 
-type ContainerMetric struct {
-	Timestamp string        `json:"timestamp"`
-	CPU       float64       `json:"CPU"`
-	Memory    MemoryMetric  `json:"Memory"`
-	Network   NetworkMetric `json:"Network"`
-	BlockIO   BlockIOMetric `json:"BlockIO"`
-	Container string        `json:"Container"`
-	ID        string        `json:"ID"`
-	Name      string        `json:"Name"`
+// DockerEvent is an entry of the Docker Engine API /events stream. For
+// containers the attributes hold the name, the labels and action details
+// such as exitCode or signal.
+type DockerEvent struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+	TimeNano int64 `json:"timeNano"`
 }
 
-type MemoryMetric struct {
-	Percentage float64 `json:"percentage"`
-	Used       float64 `json:"used"`
-	Total      float64 `json:"total"`
-	Unit       string  `json:"unit"`
+// ContainerInspect is the part of the /containers/{id}/json response that
+// describes the state and the resource limits of the container
+type ContainerInspect struct {
+	State struct {
+		Status     string `json:"Status"`
+		Pid        int    `json:"Pid"` // of the init process in the host PID namespace, 0 when stopped
+		OOMKilled  bool   `json:"OOMKilled"`
+		ExitCode   int    `json:"ExitCode"`
+		StartedAt  string `json:"StartedAt"`
+		FinishedAt string `json:"FinishedAt"`
+		Health     *struct {
+			Status string `json:"Status"`
+		} `json:"Health"`
+	} `json:"State"`
+	RestartCount int `json:"RestartCount"`
+
+	// Only returned when the size is requested
+	SizeRw     *int64 `json:"SizeRw"`
+	SizeRootFs *int64 `json:"SizeRootFs"`
+
+	HostConfig struct {
+		NanoCPUs          int64  `json:"NanoCpus"`
+		CPUQuota          int64  `json:"CpuQuota"`
+		CPUPeriod         int64  `json:"CpuPeriod"`
+		CpusetCpus        string `json:"CpusetCpus"`
+		Memory            uint64 `json:"Memory"`
+		MemoryReservation uint64 `json:"MemoryReservation"`
+	} `json:"HostConfig"`
+}
+
+// DockerDiskUsage is the /system/df response, what `docker system df -v`
+// shows. Sizes the daemon did not compute are -1.
+type DockerDiskUsage struct {
+	LayersSize int64                `json:"LayersSize"`
+	Images     []DiskUsageImage     `json:"Images"`
+	Containers []DiskUsageContainer `json:"Containers"`
+	Volumes    []DiskUsageVolume    `json:"Volumes"`
+	BuildCache []DiskUsageCache     `json:"BuildCache"`
+}
+
+type DiskUsageImage struct {
+	ID         string   `json:"Id"`
+	RepoTags   []string `json:"RepoTags"`
+	Size       int64    `json:"Size"`
+	SharedSize int64    `json:"SharedSize"`
+	Containers int64    `json:"Containers"`
+}
+
+// DiskUsageContainer is a container entry of /system/df, which lists stopped
+// containers too
+type DiskUsageContainer struct {
+	DockerContainer
+	ImageID string `json:"ImageID"`
+	SizeRw  int64  `json:"SizeRw"`
+	Mounts  []struct {
+		Type string `json:"Type"`
+		Name string `json:"Name"`
+	} `json:"Mounts"`
+}
+
+type DiskUsageVolume struct {
+	Name      string            `json:"Name"`
+	Labels    map[string]string `json:"Labels"`
+	UsageData *struct {
+		Size     int64 `json:"Size"`
+		RefCount int64 `json:"RefCount"`
+	} `json:"UsageData"`
+}
+
+type DiskUsageCache struct {
+	ID     string `json:"ID"`
+	Size   int64  `json:"Size"`
+	InUse  bool   `json:"InUse"`
+	Shared bool   `json:"Shared"`
+}
+
+// ContainerStats is the raw /containers/{id}/stats response
+type ContainerStats struct {
+	Read        string                  `json:"read"`
+	ID          string                  `json:"id"`
+	Name        string                  `json:"name"`
+	CPUStats    CPUStats                `json:"cpu_stats"`
+	PreCPUStats CPUStats                `json:"precpu_stats"`
+	MemoryStats MemoryStats             `json:"memory_stats"`
+	Networks    map[string]NetworkStats `json:"networks"`
+	BlkioStats  BlkioStats              `json:"blkio_stats"`
+	PidsStats   PidsStats               `json:"pids_stats"`
+}
+
+type CPUStats struct {
+	CPUUsage struct {
+		TotalUsage  uint64   `json:"total_usage"`
+		PercpuUsage []uint64 `json:"percpu_usage"`
+	} `json:"cpu_usage"`
+	SystemUsage    uint64 `json:"system_cpu_usage"`
+	OnlineCPUs     uint32 `json:"online_cpus"`
+	ThrottlingData struct {
+		Periods          uint64 `json:"periods"`
+		ThrottledPeriods uint64 `json:"throttled_periods"`
+		ThrottledTime    uint64 `json:"throttled_time"`
+	} `json:"throttling_data"`
+}
+
+type MemoryStats struct {
+	Usage uint64            `json:"usage"`
+	Limit uint64            `json:"limit"`
+	Stats map[string]uint64 `json:"stats"`
+}
+
+type NetworkStats struct {
+	RxBytes uint64 `json:"rx_bytes"`
+	TxBytes uint64 `json:"tx_bytes"`
+}
+
+type PidsStats struct {
+	Current uint64 `json:"current"`
+	Limit   uint64 `json:"limit"`
 }
 
-type NetworkMetric struct {
-	Input      float64 `json:"input"`
-	Output     float64 `json:"output"`
-	InputUnit  string  `json:"inputUnit"`
-	OutputUnit string  `json:"outputUnit"`
+type BlkioStats struct {
+	IoServiceBytesRecursive []BlkioStatEntry `json:"io_service_bytes_recursive"`
 }
 
-type BlockIOMetric struct {
-	Read      float64 `json:"read"`
-	Write     float64 `json:"write"`
-	ReadUnit  string  `json:"readUnit"`
-	WriteUnit string  `json:"writeUnit"`
+type BlkioStatEntry struct {
+	Major uint64 `json:"major"`
+	Minor uint64 `json:"minor"`
+	Op    string `json:"op"`
+	Value uint64 `json:"value"`
 }
 
 type MonitoringConfig struct {
-	IncludeServices []string `json:"includeServices"`
-	ExcludeServices []string `json:"excludeServices"`
+	IncludeServices []ServiceSelector
+	ExcludeServices []ServiceSelector
 }
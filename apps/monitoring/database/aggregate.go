@@ -0,0 +1,364 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// driverName is go-sqlite3 with the percentile aggregates registered on
+// every connection
+const driverName = "sqlite3_monitoring"
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			for name, q := range map[string]float64{"p50": 0.50, "p95": 0.95, "p99": 0.99} {
+				q := q
+				if err := conn.RegisterAggregator(name, func() *percentile { return &percentile{q: q} }, true); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// percentile is a SQLite aggregate computing a percentile with linear
+// interpolation between the closest ranks
+type percentile struct {
+	q      float64
+	values []float64
+}
+
+func (p *percentile) Step(value interface{}) {
+	switch v := value.(type) {
+	case int64:
+		p.values = append(p.values, float64(v))
+	case float64:
+		p.values = append(p.values, v)
+	}
+}
+
+func (p *percentile) Done() interface{} {
+	if len(p.values) == 0 {
+		return nil
+	}
+	sort.Float64s(p.values)
+
+	rank := p.q * float64(len(p.values)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return p.values[lower] + (p.values[upper]-p.values[lower])*(rank-float64(lower))
+}
+
+// Aggregations accepted for bucketed queries
+var Aggregations = map[string]string{
+	"avg":  "avg",
+	"min":  "min",
+	"max":  "max",
+	"p50":  "p50",
+	"p95":  "p95",
+	"p99":  "p99",
+	"last": "",
+}
+
+// BucketQuery selects the samples to bucket. A zero From/To means unbounded.
+type BucketQuery struct {
+	From        time.Time
+	To          time.Time
+	Step        time.Duration
+	Aggregation string
+}
+
+func (q BucketQuery) validate() error {
+	if _, ok := Aggregations[q.Aggregation]; !ok {
+		return fmt.Errorf("unknown aggregation %q", q.Aggregation)
+	}
+	if q.Step < time.Second {
+		return fmt.Errorf("step must be at least 1s")
+	}
+	return nil
+}
+
+// aggregateExpr wraps a numeric expression in the aggregation. "last" keeps
+// the bare expression: SQLite takes bare columns from the row selected by
+// the only max() of the query, which is max(timestamp).
+func (q BucketQuery) aggregateExpr(expr string) string {
+	fn := Aggregations[q.Aggregation]
+	if fn == "" {
+		return expr
+	}
+	return fn + "(" + expr + ")"
+}
+
+const bucketExpr = `CAST(strftime('%s', timestamp) AS INTEGER) / ? * ?`
+
+func (q BucketQuery) rangeFilter() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if !q.From.IsZero() {
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, rangeStart(q.From))
+	}
+	if !q.To.IsZero() {
+		conditions = append(conditions, "timestamp <= ?")
+		args = append(args, rangeEnd(q.To))
+	}
+	if len(conditions) == 0 {
+		return "1 = 1", nil
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// bucketSelects aggregates each numeric column over the bucket, rounding
+// integer columns like the container fields. Text columns are taken from one
+// of its rows, or are part of the GROUP BY.
+func bucketSelects[T any](columns []column[T], q BucketQuery) []string {
+	selects := []string{bucketExpr + " AS bucket", "max(timestamp) AS last_timestamp"}
+	for _, col := range columns {
+		switch col.kind {
+		case columnText:
+			selects = append(selects, col.name)
+		case columnInteger:
+			selects = append(selects, "CAST(round("+q.aggregateExpr(col.name)+") AS INTEGER)")
+		default:
+			selects = append(selects, q.aggregateExpr(col.name))
+		}
+	}
+	return selects
+}
+
+func bucketTimestamp(bucket int64) string {
+	return time.Unix(bucket, 0).UTC().Format(time.RFC3339Nano)
+}
+
+// GetBucketedMetrics returns one server sample per step, each numeric column
+// aggregated over the bucket and text columns taken from one of its rows
+func (db *DB) GetBucketedMetrics(q BucketQuery) ([]ServerMetric, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+
+	selects := bucketSelects(serverColumns[1:], q)
+	filter, filterArgs := q.rangeFilter()
+	step := int64(q.Step / time.Second)
+	args := append([]interface{}{step, step}, filterArgs...)
+
+	rows, err := db.Query(`
+		SELECT `+strings.Join(selects, ", ")+`
+		FROM server_metrics
+		WHERE `+filter+`
+		GROUP BY bucket
+		ORDER BY bucket ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var metrics []ServerMetric
+	for rows.Next() {
+		var m ServerMetric
+		var bucket int64
+		var lastTimestamp string
+		targets := append([]interface{}{&bucket, &lastTimestamp}, scanTargets(serverColumns, &m)[1:]...)
+		if err := rows.Scan(targets...); err != nil {
+			return nil, err
+		}
+		m.Timestamp = bucketTimestamp(bucket)
+		metrics = append(metrics, m)
+	}
+	return metrics, rows.Err()
+}
+
+type containerField struct {
+	path string
+	set  func(m *ContainerMetric, value float64)
+}
+
+// containerFields lists the numeric fields of ContainerMetric that are
+// aggregated by GetBucketedContainerMetrics
+var containerFields = []containerField{
+	{path: "$.CPU", set: func(m *ContainerMetric, v float64) { m.CPU = v }},
+	{path: "$.Memory.percentage", set: func(m *ContainerMetric, v float64) { m.Memory.Percentage = v }},
+	{path: "$.Memory.used", set: func(m *ContainerMetric, v float64) { m.Memory.Used = uint64(math.Round(v)) }},
+	{path: "$.Memory.total", set: func(m *ContainerMetric, v float64) { m.Memory.Total = uint64(math.Round(v)) }},
+	{path: "$.Network.input", set: func(m *ContainerMetric, v float64) { m.Network.Input = uint64(math.Round(v)) }},
+	{path: "$.Network.output", set: func(m *ContainerMetric, v float64) { m.Network.Output = uint64(math.Round(v)) }},
+	{path: "$.Network.inputBytes", set: func(m *ContainerMetric, v float64) { m.Network.InputBytes = uint64(math.Round(v)) }},
+	{path: "$.Network.outputBytes", set: func(m *ContainerMetric, v float64) { m.Network.OutputBytes = uint64(math.Round(v)) }},
+	{path: "$.Network.inputRate", set: func(m *ContainerMetric, v float64) { m.Network.InputRate = v }},
+	{path: "$.Network.outputRate", set: func(m *ContainerMetric, v float64) { m.Network.OutputRate = v }},
+	{path: "$.BlockIO.read", set: func(m *ContainerMetric, v float64) { m.BlockIO.Read = uint64(math.Round(v)) }},
+	{path: "$.BlockIO.write", set: func(m *ContainerMetric, v float64) { m.BlockIO.Write = uint64(math.Round(v)) }},
+	{path: "$.Pids", set: func(m *ContainerMetric, v float64) { m.Pids = uint64(math.Round(v)) }},
+}
+
+func init() {
+	containerFields = append(containerFields, pressureFields()...)
+	containerFields = append(containerFields, stateFields()...)
+	containerFields = append(containerFields, limitFields()...)
+	containerFields = append(containerFields, processFields()...)
+}
+
+// stateFields aggregates the numeric fields of ContainerState. With agg=max
+// the restart count of a bucket is the one at its end.
+func stateFields() []containerField {
+	state := func(m *ContainerMetric) *ContainerState {
+		if m.State == nil {
+			m.State = &ContainerState{}
+		}
+		return m.State
+	}
+	return []containerField{
+		{path: "$.State.restartCount", set: func(m *ContainerMetric, v float64) { state(m).RestartCount = int(math.Round(v)) }},
+		{path: "$.State.uptime", set: func(m *ContainerMetric, v float64) { state(m).Uptime = int64(math.Round(v)) }},
+	}
+}
+
+// limitFields aggregates the numeric fields of ContainerLimits and
+// ContainerThrottling
+func limitFields() []containerField {
+	limits := func(m *ContainerMetric) *ContainerLimits {
+		if m.Limits == nil {
+			m.Limits = &ContainerLimits{}
+		}
+		return m.Limits
+	}
+	throttling := func(m *ContainerMetric) *ContainerThrottling {
+		if m.Throttling == nil {
+			m.Throttling = &ContainerThrottling{}
+		}
+		return m.Throttling
+	}
+	return []containerField{
+		{path: "$.Limits.cpuQuota", set: func(m *ContainerMetric, v float64) { limits(m).CPUQuota = int64(math.Round(v)) }},
+		{path: "$.Limits.cpuPeriod", set: func(m *ContainerMetric, v float64) { limits(m).CPUPeriod = int64(math.Round(v)) }},
+		{path: "$.Limits.cpus", set: func(m *ContainerMetric, v float64) { limits(m).CPUs = v }},
+		{path: "$.Limits.memory", set: func(m *ContainerMetric, v float64) { limits(m).Memory = uint64(math.Round(v)) }},
+		{path: "$.Limits.memoryReservation", set: func(m *ContainerMetric, v float64) { limits(m).MemoryReservation = uint64(math.Round(v)) }},
+		{path: "$.Limits.cpuPercent", set: func(m *ContainerMetric, v float64) { limits(m).CPUPercent = v }},
+		{path: "$.Limits.memoryPercent", set: func(m *ContainerMetric, v float64) { limits(m).MemoryPercent = v }},
+		{path: "$.Throttling.periods", set: func(m *ContainerMetric, v float64) { throttling(m).Periods = uint64(math.Round(v)) }},
+		{path: "$.Throttling.throttledPeriods", set: func(m *ContainerMetric, v float64) { throttling(m).ThrottledPeriods = uint64(math.Round(v)) }},
+		{path: "$.Throttling.throttledTime", set: func(m *ContainerMetric, v float64) { throttling(m).ThrottledTime = uint64(math.Round(v)) }},
+		{path: "$.Throttling.throttledPercent", set: func(m *ContainerMetric, v float64) { throttling(m).ThrottledPercent = v }},
+	}
+}
+
+// processFields aggregates the pids limit, the process and open file counts
+// and the filesystem sizes
+func processFields() []containerField {
+	filesystem := func(m *ContainerMetric) *ContainerFilesystem {
+		if m.Filesystem == nil {
+			m.Filesystem = &ContainerFilesystem{}
+		}
+		return m.Filesystem
+	}
+	return []containerField{
+		{path: "$.PidsLimit", set: func(m *ContainerMetric, v float64) { m.PidsLimit = uint64(math.Round(v)) }},
+		{path: "$.PidsPercent", set: func(m *ContainerMetric, v float64) { m.PidsPercent = v }},
+		{path: "$.Processes", set: func(m *ContainerMetric, v float64) { m.Processes = uint64(math.Round(v)) }},
+		{path: "$.FDs", set: func(m *ContainerMetric, v float64) { m.FDs = uint64(math.Round(v)) }},
+		{path: "$.Filesystem.sizeRw", set: func(m *ContainerMetric, v float64) { filesystem(m).SizeRw = uint64(math.Round(v)) }},
+		{path: "$.Filesystem.sizeRootFs", set: func(m *ContainerMetric, v float64) { filesystem(m).SizeRootFs = uint64(math.Round(v)) }},
+	}
+}
+
+// pressureFields aggregates every value of ContainerMetric.Pressure. The
+// aggregate is NULL for containers without PSI, which keep a nil Pressure.
+func pressureFields() []containerField {
+	var fields []containerField
+	for _, resource := range []string{"cpu", "memory", "io"} {
+		resource := resource
+		for _, line := range []string{"some", "full"} {
+			line := line
+			stall := func(m *ContainerMetric) *PressureStall {
+				if m.Pressure == nil {
+					m.Pressure = &PressureMetric{}
+				}
+				r := m.Pressure.Resources()[resource]
+				if line == "some" {
+					return &r.Some
+				}
+				return &r.Full
+			}
+			path := "$.Pressure." + resource + "." + line + "."
+			fields = append(fields,
+				containerField{path: path + "avg10", set: func(m *ContainerMetric, v float64) { stall(m).Avg10 = v }},
+				containerField{path: path + "avg60", set: func(m *ContainerMetric, v float64) { stall(m).Avg60 = v }},
+				containerField{path: path + "avg300", set: func(m *ContainerMetric, v float64) { stall(m).Avg300 = v }},
+				containerField{path: path + "total", set: func(m *ContainerMetric, v float64) { stall(m).Total = uint64(math.Round(v)) }},
+			)
+		}
+	}
+	return fields
+}
+
+// GetBucketedContainerMetrics returns one sample per step and container.
+// Sizes are returned in bytes.
+func (db *DB) GetBucketedContainerMetrics(containerName string, q BucketQuery) ([]ContainerMetric, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	containerName = strings.TrimPrefix(containerName, "/")
+
+	selects := []string{bucketExpr + " AS bucket", "max(timestamp) AS last_timestamp", "metrics_json"}
+	for _, field := range containerFields {
+		expr := fmt.Sprintf("json_extract(metrics_json, '%s')", field.path)
+		selects = append(selects, q.aggregateExpr(expr))
+	}
+
+	filter, filterArgs := q.rangeFilter()
+	step := int64(q.Step / time.Second)
+	args := []interface{}{step, step}
+	args = append(args, containerAppArgs(containerName)...)
+	args = append(args, filterArgs...)
+
+	rows, err := db.Query(`
+		SELECT `+strings.Join(selects, ", ")+`
+		FROM container_metrics
+		WHERE (`+containerAppFilter+`) AND `+filter+`
+		GROUP BY bucket, container_name
+		ORDER BY bucket ASC, container_name ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var metrics []ContainerMetric
+	for rows.Next() {
+		var bucket int64
+		var lastTimestamp, metricsJSON string
+		values := make([]sql.NullFloat64, len(containerFields))
+
+		targets := []interface{}{&bucket, &lastTimestamp, &metricsJSON}
+		for i := range values {
+			targets = append(targets, &values[i])
+		}
+		if err := rows.Scan(targets...); err != nil {
+			return nil, err
+		}
+
+		var m ContainerMetric
+		if err := json.Unmarshal([]byte(metricsJSON), &m); err != nil {
+			return nil, err
+		}
+		for i, field := range containerFields {
+			if values[i].Valid {
+				field.set(&m, values[i].Float64)
+			}
+		}
+		m.Timestamp = bucketTimestamp(bucket)
+		metrics = append(metrics, m)
+	}
+	return metrics, rows.Err()
+}
@@ -0,0 +1,193 @@
+package database
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// The first bucket holds 10, 20, 30, 40 and 100, the latest sample being 20.
+// The next one starts exactly on the minute.
+var bucketSeries = []struct {
+	timestamp string
+	cpu       float64
+}{
+	{"2024-01-01T00:00:00Z", 40},
+	{"2024-01-01T00:00:10Z", 10},
+	{"2024-01-01T00:00:20Z", 30},
+	{"2024-01-01T00:00:30Z", 100},
+	{"2024-01-01T00:00:59.5Z", 20},
+	{"2024-01-01T00:01:00Z", 5},
+}
+
+var bucketAggregations = []struct {
+	agg  string
+	want float64
+}{
+	{"avg", 40},
+	{"min", 10},
+	{"max", 100},
+	{"p50", 30},
+	// Interpolated between 40 and 100
+	{"p95", 88},
+	{"p99", 97.6},
+	{"last", 20},
+}
+
+const (
+	firstBucket  = "2024-01-01T00:00:00Z"
+	secondBucket = "2024-01-01T00:01:00Z"
+)
+
+func closeTo(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestGetBucketedMetrics(t *testing.T) {
+	db := newTestServerDB(t)
+	for _, sample := range bucketSeries {
+		metric := ServerMetric{Timestamp: sample.timestamp, CPU: sample.cpu, CPUCores: int32(sample.cpu), OS: "linux"}
+		if err := db.SaveMetric(metric); err != nil {
+			t.Fatalf("SaveMetric: %v", err)
+		}
+	}
+
+	for _, tt := range bucketAggregations {
+		t.Run(tt.agg, func(t *testing.T) {
+			metrics, err := db.GetBucketedMetrics(BucketQuery{Step: time.Minute, Aggregation: tt.agg})
+			if err != nil {
+				t.Fatalf("GetBucketedMetrics: %v", err)
+			}
+			if len(metrics) != 2 {
+				t.Fatalf("got %d buckets, want 2", len(metrics))
+			}
+			if metrics[0].Timestamp != firstBucket || metrics[1].Timestamp != secondBucket {
+				t.Errorf("got buckets %s and %s", metrics[0].Timestamp, metrics[1].Timestamp)
+			}
+			if !closeTo(metrics[0].CPU, tt.want) || metrics[1].CPU != 5 {
+				t.Errorf("got CPU %v and %v, want %v and 5", metrics[0].CPU, metrics[1].CPU, tt.want)
+			}
+			// Integer columns are rounded to the nearest integer
+			if want := int32(math.Round(tt.want)); metrics[0].CPUCores != want {
+				t.Errorf("got %d cores, want %d", metrics[0].CPUCores, want)
+			}
+			if metrics[0].OS != "linux" {
+				t.Errorf("got OS %q", metrics[0].OS)
+			}
+		})
+	}
+}
+
+func TestGetBucketedContainerMetrics(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.InitContainerMetricsTable(); err != nil {
+		t.Fatalf("InitContainerMetricsTable: %v", err)
+	}
+	for _, sample := range bucketSeries {
+		metric := &ContainerMetric{
+			Timestamp: sample.timestamp,
+			CPU:       sample.cpu,
+			Memory:    MemoryMetric{Used: uint64(sample.cpu)},
+			ID:        "web1",
+			Name:      "web.1.abc",
+			Service:   "web",
+		}
+		if err := db.SaveContainerMetric(metric); err != nil {
+			t.Fatalf("SaveContainerMetric: %v", err)
+		}
+	}
+
+	for _, tt := range bucketAggregations {
+		t.Run(tt.agg, func(t *testing.T) {
+			metrics, err := db.GetBucketedContainerMetrics("web", BucketQuery{Step: time.Minute, Aggregation: tt.agg})
+			if err != nil {
+				t.Fatalf("GetBucketedContainerMetrics: %v", err)
+			}
+			if len(metrics) != 2 {
+				t.Fatalf("got %d buckets, want 2", len(metrics))
+			}
+			if metrics[0].Timestamp != firstBucket || metrics[1].Timestamp != secondBucket {
+				t.Errorf("got buckets %s and %s", metrics[0].Timestamp, metrics[1].Timestamp)
+			}
+			if !closeTo(metrics[0].CPU, tt.want) || metrics[1].CPU != 5 {
+				t.Errorf("got CPU %v and %v, want %v and 5", metrics[0].CPU, metrics[1].CPU, tt.want)
+			}
+			// Byte counts are rounded to the nearest integer
+			if want := uint64(math.Round(tt.want)); metrics[0].Memory.Used != want {
+				t.Errorf("got %d bytes used, want %d", metrics[0].Memory.Used, want)
+			}
+			if metrics[0].Name != "web.1.abc" {
+				t.Errorf("got name %q", metrics[0].Name)
+			}
+		})
+	}
+}
+
+func TestBucketQueryRange(t *testing.T) {
+	db := newTestServerDB(t)
+	for _, sample := range bucketSeries {
+		if err := db.SaveMetric(ServerMetric{Timestamp: sample.timestamp, CPU: sample.cpu}); err != nil {
+			t.Fatalf("SaveMetric: %v", err)
+		}
+	}
+
+	from := time.Date(2024, 1, 1, 0, 0, 10, 0, time.UTC)
+	to := time.Date(2024, 1, 1, 0, 0, 30, 0, time.UTC)
+	metrics, err := db.GetBucketedMetrics(BucketQuery{From: from, To: to, Step: time.Minute, Aggregation: "avg"})
+	if err != nil {
+		t.Fatalf("GetBucketedMetrics: %v", err)
+	}
+	// Both ends are inclusive
+	if len(metrics) != 1 || metrics[0].Timestamp != firstBucket || !closeTo(metrics[0].CPU, (10+30+100)/3.0) {
+		t.Errorf("got %+v, want one bucket averaging 10, 30 and 100", metrics)
+	}
+}
+
+func TestBucketQueryValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		q    BucketQuery
+	}{
+		{"unknown aggregation", BucketQuery{Step: time.Minute, Aggregation: "sum"}},
+		{"no aggregation", BucketQuery{Step: time.Minute}},
+		{"step below a second", BucketQuery{Step: 500 * time.Millisecond, Aggregation: "avg"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newTestServerDB(t).GetBucketedMetrics(tt.q); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		q      float64
+		values []interface{}
+		want   interface{}
+	}{
+		{0.5, nil, nil},
+		{0.5, []interface{}{int64(7)}, 7.0},
+		{0.5, []interface{}{int64(1), 4.0}, 2.5},
+		{0.99, []interface{}{3.0, int64(1), 2.0}, 2.98},
+		// NULL and text values are skipped
+		{0.5, []interface{}{nil, "x", 2.0}, 2.0},
+	}
+	for _, tt := range tests {
+		p := &percentile{q: tt.q}
+		for _, value := range tt.values {
+			p.Step(value)
+		}
+		got := p.Done()
+		if tt.want == nil {
+			if got != nil {
+				t.Errorf("p%v of %v: got %v, want NULL", tt.q*100, tt.values, got)
+			}
+			continue
+		}
+		if f, ok := got.(float64); !ok || !closeTo(f, tt.want.(float64)) {
+			t.Errorf("p%v of %v: got %v, want %v", tt.q*100, tt.values, got, tt.want)
+		}
+	}
+}
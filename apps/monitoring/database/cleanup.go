@@ -8,30 +8,47 @@ import (
 	"github.com/robfig/cron/v3"
 )
 
+// metricTables are the tables whose rows expire after the retention period
+var metricTables = []string{
+	"container_metrics",
+	"container_events",
+	"docker_disk_usage",
+	"docker_disk_items",
+	"server_metrics",
+	"server_network_metrics",
+	"server_disk_metrics",
+	"server_diskio_metrics",
+	"server_cpu_metrics",
+}
+
 // CleanupMetrics deletes metrics older than the retention period
 func CleanupMetrics(db *sql.DB, retentionDays int) error {
 	cutoffDate := time.Now().AddDate(0, 0, -retentionDays)
 	cutoffDateStr := cutoffDate.UTC().Format(time.RFC3339Nano)
 
-	containerQuery := `DELETE FROM container_metrics WHERE timestamp < ?`
-	_, err := db.Exec(containerQuery, cutoffDateStr)
-	if err != nil {
-		return err
-	}
-
-	serverQuery := `DELETE FROM server_metrics WHERE timestamp < ?`
-	_, err = db.Exec(serverQuery, cutoffDateStr)
-	if err != nil {
-		return err
+	for _, table := range metricTables {
+		_, err := db.Exec(`DELETE FROM `+table+` WHERE timestamp < ?`, cutoffDateStr)
+		if err != nil {
+			return err
+		}
 	}
 
 	log.Printf("Metrics deleted (older than %d days)", retentionDays)
-	log.Printf("Cutoff date for both tables: %s", cutoffDateStr)
+	log.Printf("Cutoff date for all tables: %s", cutoffDateStr)
 	return nil
 }
 
-// StartMetricsCleanup starts a cron job to periodically clean up metrics
-func StartMetricsCleanup(db *sql.DB, retentionDays int, cronExpression string) (*cron.Cron, error) {
+// CleanupProcessSnapshots deletes the process snapshots older than
+// retention, which is shorter than the metrics one
+func CleanupProcessSnapshots(db *sql.DB, retention time.Duration) error {
+	cutoff := time.Now().Add(-retention).UTC().Format(time.RFC3339Nano)
+	_, err := db.Exec(`DELETE FROM `+processTable.name+` WHERE timestamp < ?`, cutoff)
+	return err
+}
+
+// StartMetricsCleanup starts a cron job to periodically clean up metrics.
+// Process snapshots are kept for hours, so they are cleaned up every hour.
+func StartMetricsCleanup(db *sql.DB, retentionDays int, cronExpression string, processRetention time.Duration) (*cron.Cron, error) {
 	c := cron.New()
 
 	_, err := c.AddFunc(cronExpression, func() {
@@ -44,9 +61,18 @@ func StartMetricsCleanup(db *sql.DB, retentionDays int, cronExpression string) (
 		return nil, err
 	}
 
+	_, err = c.AddFunc("@hourly", func() {
+		if err := CleanupProcessSnapshots(db, processRetention); err != nil {
+			log.Printf("Error deleting old process snapshots: %v", err)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	c.Start()
-	log.Printf("Started metrics cleanup job (retention: %d days, cron: %s)",
-		retentionDays, cronExpression)
+	log.Printf("Started metrics cleanup job (retention: %d days, cron: %s, process snapshots: %v)",
+		retentionDays, cronExpression, processRetention)
 
 	return c, nil
 }
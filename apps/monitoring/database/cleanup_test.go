@@ -0,0 +1,32 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCleanupProcessSnapshots(t *testing.T) {
+	db := newTestServerDB(t)
+
+	now := time.Now().UTC()
+	old := now.Add(-25 * time.Hour).Format(time.RFC3339Nano)
+	recent := now.Add(-time.Hour).Format(time.RFC3339Nano)
+	err := db.SaveProcessMetrics([]ProcessMetric{
+		{Timestamp: old, PID: 1, CPURank: 1},
+		{Timestamp: recent, PID: 2, CPURank: 1},
+	})
+	if err != nil {
+		t.Fatalf("SaveProcessMetrics: %v", err)
+	}
+
+	if err := CleanupProcessSnapshots(db.DB, 24*time.Hour); err != nil {
+		t.Fatalf("CleanupProcessSnapshots: %v", err)
+	}
+
+	if snapshot, err := db.GetProcessSnapshot(now.Add(-2 * time.Hour)); err != nil || snapshot != nil {
+		t.Errorf("got %+v (%v), want the old snapshot deleted", snapshot, err)
+	}
+	if snapshot, err := db.GetProcessSnapshot(time.Time{}); err != nil || snapshot == nil || snapshot.CPU[0].PID != 2 {
+		t.Errorf("got %+v (%v), want the recent snapshot", snapshot, err)
+	}
+}
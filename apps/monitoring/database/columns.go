@@ -0,0 +1,83 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+)
+
+type columnKind int
+
+const (
+	columnText columnKind = iota
+	columnInteger
+	columnReal
+)
+
+// column maps a table column to the field of T it is stored in. Tables
+// described by a column list get their inserts, selects, bucketing and
+// migrations built from it.
+type column[T any] struct {
+	name  string
+	kind  columnKind
+	field func(m *T) interface{}
+}
+
+func columnNames[T any](columns []column[T]) string {
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.name
+	}
+	return strings.Join(names, ", ")
+}
+
+func columnPlaceholders[T any](columns []column[T]) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+}
+
+func scanTargets[T any](columns []column[T], m *T) []interface{} {
+	targets := make([]interface{}, len(columns))
+	for i, col := range columns {
+		targets[i] = col.field(m)
+	}
+	return targets
+}
+
+func columnValues[T any](columns []column[T], m *T) []interface{} {
+	values := make([]interface{}, len(columns))
+	for i, col := range columns {
+		values[i] = reflect.ValueOf(col.field(m)).Elem().Interface()
+	}
+	return values
+}
+
+// columnDefinitions renders the columns for CREATE TABLE
+func columnDefinitions[T any](columns []column[T]) string {
+	definitions := make([]string, len(columns))
+	for i, col := range columns {
+		definitions[i] = col.name + " " + col.kind.definition()
+	}
+	return strings.Join(definitions, ",\n")
+}
+
+// definition is the column type. Numeric columns default to 0 so rows stored
+// before a column was added can still be scanned.
+func (k columnKind) definition() string {
+	switch k {
+	case columnInteger:
+		return "INTEGER DEFAULT 0"
+	case columnReal:
+		return "REAL DEFAULT 0"
+	default:
+		return "TEXT"
+	}
+}
+
+// migrateColumns adds the columns introduced after the table was created
+func migrateColumns[T any](db *DB, table string, columns []column[T]) error {
+	for _, col := range columns {
+		if err := db.addColumnIfMissing(table, col.name, col.kind.definition()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
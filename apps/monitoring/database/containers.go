@@ -1,9 +1,11 @@
 package database
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 )
 
 func (db *DB) InitContainerMetricsTable() error {
@@ -31,7 +33,25 @@ func (db *DB) InitContainerMetricsTable() error {
 		return fmt.Errorf("error creating name index: %v", err)
 	}
 
-	return nil
+	// Columns added after the first release, NULL on older rows
+	if err := db.addColumnIfMissing("container_metrics", "service_name", "TEXT"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("container_metrics", "project", "TEXT"); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_container_metrics_service ON container_metrics(service_name)`)
+	if err != nil {
+		return fmt.Errorf("error creating service index: %v", err)
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_container_metrics_project ON container_metrics(project)`)
+	if err != nil {
+		return fmt.Errorf("error creating project index: %v", err)
+	}
+
+	return db.migrateContainerUnits()
 }
 
 func (db *DB) SaveContainerMetric(metric *ContainerMetric) error {
@@ -41,66 +61,139 @@ func (db *DB) SaveContainerMetric(metric *ContainerMetric) error {
 	}
 
 	_, err = db.Exec(`
-		INSERT INTO container_metrics (timestamp, container_id, container_name, metrics_json)
-		VALUES (?, ?, ?, ?)
-	`, metric.Timestamp, metric.ID, metric.Name, string(metricsJSON))
+		INSERT INTO container_metrics (timestamp, container_id, container_name, service_name, project, metrics_json)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, metric.Timestamp, metric.ID, metric.Name, metric.Service, metric.Project(), string(metricsJSON))
 	return err
 }
 
+// containerAppFilter matches an appName against the Swarm service name, the
+// Compose project or Swarm stack, or the exact container name. Compose
+// service names are only unique within their project, so the service name
+// is only matched for rows without a project, or whose service carries the
+// project prefix like the services of a Swarm stack (<stack>_<service>).
+// Rows stored before the labels were recorded have no service_name and fall
+// back to the Swarm task name prefix.
+const containerAppFilter = `
+	(service_name = ? AND (coalesce(project, '') = '' OR substr(service_name, 1, length(project) + 1) = project || '_'))
+	OR project = ? OR container_name = ?
+	OR (service_name IS NULL AND container_name LIKE ?)
+`
+
+func containerAppArgs(appName string) []interface{} {
+	return []interface{}{appName, appName, appName, appName + ".%"}
+}
+
 func (db *DB) GetLastNContainerMetrics(containerName string, limit int) ([]ContainerMetric, error) {
 	containerName = strings.TrimPrefix(containerName, "/")
 
 	query := `
-		WITH recent_metrics AS (
-			SELECT metrics_json
+		WITH matching_metrics AS (
+			SELECT timestamp, container_name, metrics_json
 			FROM container_metrics
-			WHERE container_name = ? OR container_name LIKE ?
+			WHERE ` + containerAppFilter + `
+		),
+		recent_timestamps AS (
+			SELECT DISTINCT timestamp
+			FROM matching_metrics
 			ORDER BY timestamp DESC
 			LIMIT ?
 		)
-		SELECT metrics_json FROM recent_metrics ORDER BY json_extract(metrics_json, '$.timestamp') ASC
+		SELECT metrics_json FROM matching_metrics
+		WHERE timestamp IN (SELECT timestamp FROM recent_timestamps)
+		ORDER BY json_extract(metrics_json, '$.timestamp') ASC, container_name ASC
 	`
-	rows, err := db.Query(query, containerName, containerName+".%", limit)
+	rows, err := db.Query(query, append(containerAppArgs(containerName), limit)...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var metrics []ContainerMetric
-	for rows.Next() {
-		var metricsJSON string
-		err := rows.Scan(&metricsJSON)
-		if err != nil {
-			return nil, err
-		}
+	return scanContainerMetrics(rows)
+}
 
-		var metric ContainerMetric
-		if err := json.Unmarshal([]byte(metricsJSON), &metric); err != nil {
-			return nil, err
-		}
-		metrics = append(metrics, metric)
+func (db *DB) GetAllMetricsContainer(containerName string) ([]ContainerMetric, error) {
+	containerName = strings.TrimPrefix(containerName, "/")
+
+	query := `
+		SELECT metrics_json
+		FROM container_metrics
+		WHERE ` + containerAppFilter + `
+		ORDER BY json_extract(metrics_json, '$.timestamp') ASC, container_name ASC
+	`
+	rows, err := db.Query(query, containerAppArgs(containerName)...)
+	if err != nil {
+		return nil, err
 	}
-	return metrics, nil
+	defer rows.Close()
+
+	return scanContainerMetrics(rows)
 }
 
-func (db *DB) GetAllMetricsContainer(containerName string) ([]ContainerMetric, error) {
+func (db *DB) GetContainerMetricsInRange(containerName string, start, end time.Time) ([]ContainerMetric, error) {
 	containerName = strings.TrimPrefix(containerName, "/")
 
 	query := `
-		WITH recent_metrics AS (
-			SELECT metrics_json
-			FROM container_metrics
-			WHERE container_name = ? OR container_name LIKE ?
-			ORDER BY timestamp DESC
-		)
-		SELECT metrics_json FROM recent_metrics ORDER BY json_extract(metrics_json, '$.timestamp') ASC
+		SELECT metrics_json
+		FROM container_metrics
+		WHERE (` + containerAppFilter + `)
+		AND timestamp BETWEEN ? AND ?
+		ORDER BY timestamp ASC, container_name ASC
 	`
-	rows, err := db.Query(query, containerName, containerName+".%")
+	args := append(containerAppArgs(containerName), rangeStart(start), rangeEnd(end))
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	return scanContainerMetrics(rows)
+}
+
+// ContainerRestarts is how many times a container was restarted by its
+// restart policy between two times, and whether a run was OOM-killed
+type ContainerRestarts struct {
+	ContainerID  string `json:"containerId"`
+	Name         string `json:"name"`
+	Restarts     int    `json:"restarts"`
+	RestartCount int    `json:"restartCount"` // total since the container was created
+	OOMKilled    bool   `json:"oomKilled"`
+}
+
+// GetContainerRestarts compares the restart count of the first and the last
+// sample of every container of an application in the range
+func (db *DB) GetContainerRestarts(appName string, start, end time.Time) ([]ContainerRestarts, error) {
+	appName = strings.TrimPrefix(appName, "/")
+
+	rows, err := db.Query(`
+		SELECT container_id, container_name,
+			max(json_extract(metrics_json, '$.State.restartCount')) - min(json_extract(metrics_json, '$.State.restartCount')),
+			max(json_extract(metrics_json, '$.State.restartCount')),
+			max(coalesce(json_extract(metrics_json, '$.State.oomKilled'), 0))
+		FROM container_metrics
+		WHERE (`+containerAppFilter+`)
+		AND timestamp BETWEEN ? AND ?
+		AND json_extract(metrics_json, '$.State') IS NOT NULL
+		GROUP BY container_id
+		ORDER BY container_name ASC
+	`, append(containerAppArgs(appName), rangeStart(start), rangeEnd(end))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	restarts := []ContainerRestarts{}
+	for rows.Next() {
+		var r ContainerRestarts
+		if err := rows.Scan(&r.ContainerID, &r.Name, &r.Restarts, &r.RestartCount, &r.OOMKilled); err != nil {
+			return nil, err
+		}
+		restarts = append(restarts, r)
+	}
+	return restarts, rows.Err()
+}
+
+func scanContainerMetrics(rows *sql.Rows) ([]ContainerMetric, error) {
 	var metrics []ContainerMetric
 	for rows.Next() {
 		var metricsJSON string
@@ -115,7 +208,7 @@ func (db *DB) GetAllMetricsContainer(containerName string) ([]ContainerMetric, e
 		}
 		metrics = append(metrics, metric)
 	}
-	return metrics, nil
+	return metrics, rows.Err()
 }
 
 type ContainerMetric struct {
@@ -124,29 +217,125 @@ type ContainerMetric struct {
 	Memory    MemoryMetric  `json:"Memory"`
 	Network   NetworkMetric `json:"Network"`
 	BlockIO   BlockIOMetric `json:"BlockIO"`
+	Pids      uint64        `json:"Pids"`
 	Container string        `json:"Container"`
 	ID        string        `json:"ID"`
 	Name      string        `json:"Name"`
+	Service   string        `json:"Service"`
+	Replica   int           `json:"Replica"`
+
+	// Orchestrator metadata read from the container labels
+	SwarmService   string `json:"SwarmService,omitempty"`
+	SwarmTaskSlot  int    `json:"SwarmTaskSlot,omitempty"`
+	SwarmNodeID    string `json:"SwarmNodeID,omitempty"`
+	SwarmStack     string `json:"SwarmStack,omitempty"`
+	ComposeProject string `json:"ComposeProject,omitempty"`
+	ComposeService string `json:"ComposeService,omitempty"`
+
+	// Pressure stall information of the container cgroup, only on cgroup v2
+	Pressure *PressureMetric `json:"Pressure,omitempty"`
+
+	State *ContainerState `json:"State,omitempty"`
+
+	Limits     *ContainerLimits     `json:"Limits,omitempty"`
+	Throttling *ContainerThrottling `json:"Throttling,omitempty"`
+
+	// Pids counts every task, threads included. Processes and FDs are read
+	// from the container cgroup and are omitted when it cannot be found.
+	PidsLimit   uint64  `json:"PidsLimit"` // 0 when unlimited
+	PidsPercent float64 `json:"PidsPercent"`
+	Processes   uint64  `json:"Processes,omitempty"`
+	FDs         uint64  `json:"FDs,omitempty"`
+
+	Filesystem *ContainerFilesystem `json:"Filesystem,omitempty"`
+}
+
+// ContainerFilesystem is the disk used by a container. Computing it walks
+// the writable layer, so it is sampled less often than the other metrics and
+// repeated on the samples in between.
+type ContainerFilesystem struct {
+	SizeRw     uint64 `json:"sizeRw"`     // bytes written to the writable layer
+	SizeRootFs uint64 `json:"sizeRootFs"` // bytes of the whole root filesystem, image included
+	SampledAt  string `json:"sampledAt"`
+}
+
+// ContainerState is read from the container inspect, which is cached until
+// an event of the container
+type ContainerState struct {
+	Status       string `json:"status"`           // running, restarting, paused, ...
+	Health       string `json:"health,omitempty"` // healthy, unhealthy or starting; empty without a health check
+	RestartCount int    `json:"restartCount"`     // restarts by the restart policy since the container was created
+	ExitCode     int    `json:"exitCode"`         // of the last run
+	OOMKilled    bool   `json:"oomKilled"`        // the last run was killed for running out of memory
+	StartedAt    string `json:"startedAt"`
+	Uptime       int64  `json:"uptime"` // seconds since StartedAt
+}
+
+// ContainerLimits are the resources configured for a container and its usage
+// relative to them. Without a CPU or memory limit the percentages are
+// relative to the host, which is what the container can use.
+type ContainerLimits struct {
+	CPUQuota          int64   `json:"cpuQuota"`  // microseconds of CPU time per period, 0 when unlimited
+	CPUPeriod         int64   `json:"cpuPeriod"` // microseconds
+	Cpuset            string  `json:"cpuset,omitempty"`
+	CPUs              float64 `json:"cpus"`              // cores the container can use
+	Memory            uint64  `json:"memory"`            // bytes, 0 when unlimited
+	MemoryReservation uint64  `json:"memoryReservation"` // bytes, 0 when not set
+	CPUPercent        float64 `json:"cpuPercent"`        // usage as a share of cpus
+	MemoryPercent     float64 `json:"memoryPercent"`     // usage as a share of memory
 }
 
+// ContainerThrottling holds the CFS bandwidth counters of a container cgroup,
+// cumulative since it was created
+type ContainerThrottling struct {
+	Periods          uint64  `json:"periods"`          // enforcement periods that elapsed while the container ran
+	ThrottledPeriods uint64  `json:"throttledPeriods"` // periods in which the quota was exhausted
+	ThrottledTime    uint64  `json:"throttledTime"`    // nanoseconds
+	ThrottledPercent float64 `json:"throttledPercent"` // share of the periods since the previous sample that were throttled
+}
+
+// SetPercent computes the throttled share of the periods since the previous
+// sample of the container
+func (t *ContainerThrottling) SetPercent(previous ContainerThrottling) {
+	periods := counterDelta(previous.Periods, t.Periods)
+	if periods == 0 {
+		return
+	}
+	throttled := counterDelta(previous.ThrottledPeriods, t.ThrottledPeriods)
+	t.ThrottledPercent = round2(float64(throttled) / float64(periods) * 100)
+}
+
+// Project returns the Compose project or Swarm stack the container belongs to
+func (m *ContainerMetric) Project() string {
+	if m.ComposeProject != "" {
+		return m.ComposeProject
+	}
+	return m.SwarmStack
+}
+
+// MemoryMetric is the memory usage of a container, in bytes
 type MemoryMetric struct {
 	Percentage float64 `json:"percentage"`
-	Used       float64 `json:"used"`
-	Total      float64 `json:"total"`
-	UsedUnit   string  `json:"usedUnit"`
-	TotalUnit  string  `json:"totalUnit"`
+	Used       uint64  `json:"used"`
+	Total      uint64  `json:"total"`
 }
 
 type NetworkMetric struct {
-	Input      float64 `json:"input"`
-	Output     float64 `json:"output"`
-	InputUnit  string  `json:"inputUnit"`
-	OutputUnit string  `json:"outputUnit"`
+	// Cumulative bytes as stored. The API replaces them by the rates,
+	// rounded to bytes per second, unless raw counters are requested.
+	Input  uint64 `json:"input"`
+	Output uint64 `json:"output"`
+
+	// Raw counters in bytes and the rates in bytes per second since the
+	// previous sample of the container
+	InputBytes  uint64  `json:"inputBytes"`
+	OutputBytes uint64  `json:"outputBytes"`
+	InputRate   float64 `json:"inputRate"`
+	OutputRate  float64 `json:"outputRate"`
 }
 
+// BlockIOMetric holds the cumulative bytes read and written by a container
 type BlockIOMetric struct {
-	Read      float64 `json:"read"`
-	Write     float64 `json:"write"`
-	ReadUnit  string  `json:"readUnit"`
-	WriteUnit string  `json:"writeUnit"`
+	Read  uint64 `json:"read"`
+	Write uint64 `json:"write"`
 }
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestContainerAppFilter(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.InitContainerMetricsTable(); err != nil {
+		t.Fatalf("InitContainerMetricsTable: %v", err)
+	}
+
+	metrics := []*ContainerMetric{
+		// Two Compose projects with a service of the same name
+		{ID: "shop1", Name: "shop-web-1", Service: "web", ComposeProject: "shop", ComposeService: "web"},
+		{ID: "blog1", Name: "blog-web-1", Service: "web", ComposeProject: "blog", ComposeService: "web"},
+		// A Swarm application and the service of a stack
+		{ID: "web1", Name: "web.1.abc", Service: "web", SwarmService: "web"},
+		{ID: "crm1", Name: "crm_api.1.def", Service: "crm_api", SwarmService: "crm_api", SwarmStack: "crm"},
+	}
+	for _, metric := range metrics {
+		metric.Timestamp = "2024-01-01T00:00:00Z"
+		if err := db.SaveContainerMetric(metric); err != nil {
+			t.Fatalf("SaveContainerMetric: %v", err)
+		}
+	}
+
+	tests := []struct {
+		appName string
+		want    []string
+	}{
+		{"web", []string{"web.1.abc"}},
+		{"shop", []string{"shop-web-1"}},
+		{"blog", []string{"blog-web-1"}},
+		{"crm_api", []string{"crm_api.1.def"}},
+		{"crm", []string{"crm_api.1.def"}},
+		{"blog-web-1", []string{"blog-web-1"}},
+		{"db", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.appName, func(t *testing.T) {
+			got, err := db.GetAllMetricsContainer(tt.appName)
+			if err != nil {
+				t.Fatalf("GetAllMetricsContainer: %v", err)
+			}
+			var names []string
+			for _, metric := range got {
+				names = append(names, metric.Name)
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("got %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package database
+
+import "time"
+
+// CPUCoreMetric is the utilization of one logical core over the sampling
+// interval, in percent
+type CPUCoreMetric struct {
+	Timestamp string  `json:"timestamp"`
+	Core      string  `json:"core"`
+	Usage     float64 `json:"usage"`
+	User      float64 `json:"user"`
+	System    float64 `json:"system"`
+	Iowait    float64 `json:"iowait"`
+	Steal     float64 `json:"steal"`
+	Irq       float64 `json:"irq"` // hard and soft interrupts
+}
+
+var cpuCoreTable = seriesTable[CPUCoreMetric]{
+	name: "server_cpu_metrics",
+	columns: []column[CPUCoreMetric]{
+		{"timestamp", columnText, func(m *CPUCoreMetric) interface{} { return &m.Timestamp }},
+		{"core", columnText, func(m *CPUCoreMetric) interface{} { return &m.Core }},
+		{"usage", columnReal, func(m *CPUCoreMetric) interface{} { return &m.Usage }},
+		{"user", columnReal, func(m *CPUCoreMetric) interface{} { return &m.User }},
+		{"system", columnReal, func(m *CPUCoreMetric) interface{} { return &m.System }},
+		{"iowait", columnReal, func(m *CPUCoreMetric) interface{} { return &m.Iowait }},
+		{"steal", columnReal, func(m *CPUCoreMetric) interface{} { return &m.Steal }},
+		{"irq", columnReal, func(m *CPUCoreMetric) interface{} { return &m.Irq }},
+	},
+}
+
+func (db *DB) SaveCPUCoreMetrics(metrics []CPUCoreMetric) error {
+	return cpuCoreTable.save(db, metrics)
+}
+
+// GetLastNCPUCoreMetrics returns the last n collections; every core of a
+// collection is included
+func (db *DB) GetLastNCPUCoreMetrics(cores []string, n int) ([]CPUCoreMetric, error) {
+	return cpuCoreTable.lastN(db, cores, n)
+}
+
+func (db *DB) GetAllCPUCoreMetrics(cores []string) ([]CPUCoreMetric, error) {
+	return cpuCoreTable.all(db, cores)
+}
+
+func (db *DB) GetCPUCoreMetricsInRange(cores []string, start, end time.Time) ([]CPUCoreMetric, error) {
+	return cpuCoreTable.inRange(db, cores, start, end)
+}
+
+// GetBucketedCPUCoreMetrics returns one sample per step and core
+func (db *DB) GetBucketedCPUCoreMetrics(cores []string, q BucketQuery) ([]CPUCoreMetric, error) {
+	return cpuCoreTable.bucketed(db, cores, q)
+}
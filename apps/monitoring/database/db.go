@@ -2,8 +2,8 @@ package database
 
 import (
 	"database/sql"
-
-	_ "github.com/mattn/go-sqlite3"
+	"fmt"
+	"time"
 )
 
 type DB struct {
@@ -11,7 +11,12 @@ type DB struct {
 }
 
 func InitDB() (*DB, error) {
-	db, err := sql.Open("sqlite3", "./monitoring.db")
+	return openDB("./monitoring.db")
+}
+
+// openDB opens the database at path and creates or migrates its tables
+func openDB(path string) (*DB, error) {
+	db, err := sql.Open(driverName, path)
 	if err != nil {
 		return nil, err
 	}
@@ -43,5 +48,78 @@ func InitDB() (*DB, error) {
 		return nil, err
 	}
 
-	return &DB{db}, nil
+	monitoringDB := &DB{db}
+	if err := monitoringDB.migrateServerMetrics(); err != nil {
+		return nil, err
+	}
+	if err := interfaceTable.init(monitoringDB); err != nil {
+		return nil, err
+	}
+	if err := diskTable.init(monitoringDB); err != nil {
+		return nil, err
+	}
+	if err := diskIOTable.init(monitoringDB); err != nil {
+		return nil, err
+	}
+	if err := cpuCoreTable.init(monitoringDB); err != nil {
+		return nil, err
+	}
+	if err := processTable.init(monitoringDB); err != nil {
+		return nil, err
+	}
+	if err := dockerDiskTable.init(monitoringDB); err != nil {
+		return nil, err
+	}
+	if err := dockerDiskItemTable.init(monitoringDB); err != nil {
+		return nil, err
+	}
+
+	return monitoringDB, nil
+}
+
+// addColumnIfMissing lets tables created by older versions gain new columns
+func (db *DB) addColumnIfMissing(table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("error reading %s schema: %v", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return fmt.Errorf("error reading %s schema: %v", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading %s schema: %v", table, err)
+	}
+	rows.Close()
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("error adding column %s.%s: %v", table, column, err)
+	}
+	return nil
+}
+
+// Timestamps are stored as RFC3339Nano text, which drops trailing zeros, so
+// sub-second values do not sort correctly against a bound formatted the same
+// way. Range bounds are compared at second precision instead: "." sorts
+// before any digit and "Z" after the fractional part of the same second.
+func rangeStart(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05") + "."
+}
+
+func rangeEnd(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05") + "Z"
 }
@@ -0,0 +1,32 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// newTestDB opens an empty database in a temporary directory
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	sqlDB, err := sql.Open(driverName, filepath.Join(t.TempDir(), "monitoring.db"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	return &DB{sqlDB}
+}
+
+// newTestServerDB opens a database in a temporary directory with every
+// table InitDB creates
+func newTestServerDB(t *testing.T) *DB {
+	t.Helper()
+
+	db, err := openDB(filepath.Join(t.TempDir(), "monitoring.db"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
@@ -0,0 +1,106 @@
+package database
+
+import "time"
+
+// DiskIOMetric holds the /proc/diskstats counters of one block device and
+// the throughput, IOPS, latency and utilization since the previous sample
+type DiskIOMetric struct {
+	Timestamp  string `json:"timestamp"`
+	Device     string `json:"device"`
+	ReadBytes  uint64 `json:"readBytes"`
+	WriteBytes uint64 `json:"writeBytes"`
+	ReadCount  uint64 `json:"readCount"`
+	WriteCount uint64 `json:"writeCount"`
+	ReadTime   uint64 `json:"readTime"`  // ms spent reading
+	WriteTime  uint64 `json:"writeTime"` // ms spent writing
+	IoTime     uint64 `json:"ioTime"`    // ms the device had I/O in flight
+
+	ReadBytesRate  float64 `json:"readBytesRate"`
+	WriteBytesRate float64 `json:"writeBytesRate"`
+	ReadIOPS       float64 `json:"readIops"`
+	WriteIOPS      float64 `json:"writeIops"`
+	ReadAwait      float64 `json:"readAwait"`  // average ms per read
+	WriteAwait     float64 `json:"writeAwait"` // average ms per write
+	Await          float64 `json:"await"`      // average ms per request
+	Utilization    float64 `json:"utilization"`
+}
+
+var diskIOTable = seriesTable[DiskIOMetric]{
+	name: "server_diskio_metrics",
+	columns: []column[DiskIOMetric]{
+		{"timestamp", columnText, func(m *DiskIOMetric) interface{} { return &m.Timestamp }},
+		{"device", columnText, func(m *DiskIOMetric) interface{} { return &m.Device }},
+		{"read_bytes", columnInteger, func(m *DiskIOMetric) interface{} { return &m.ReadBytes }},
+		{"write_bytes", columnInteger, func(m *DiskIOMetric) interface{} { return &m.WriteBytes }},
+		{"read_count", columnInteger, func(m *DiskIOMetric) interface{} { return &m.ReadCount }},
+		{"write_count", columnInteger, func(m *DiskIOMetric) interface{} { return &m.WriteCount }},
+		{"read_time", columnInteger, func(m *DiskIOMetric) interface{} { return &m.ReadTime }},
+		{"write_time", columnInteger, func(m *DiskIOMetric) interface{} { return &m.WriteTime }},
+		{"io_time", columnInteger, func(m *DiskIOMetric) interface{} { return &m.IoTime }},
+		{"read_bytes_rate", columnReal, func(m *DiskIOMetric) interface{} { return &m.ReadBytesRate }},
+		{"write_bytes_rate", columnReal, func(m *DiskIOMetric) interface{} { return &m.WriteBytesRate }},
+		{"read_iops", columnReal, func(m *DiskIOMetric) interface{} { return &m.ReadIOPS }},
+		{"write_iops", columnReal, func(m *DiskIOMetric) interface{} { return &m.WriteIOPS }},
+		{"read_await", columnReal, func(m *DiskIOMetric) interface{} { return &m.ReadAwait }},
+		{"write_await", columnReal, func(m *DiskIOMetric) interface{} { return &m.WriteAwait }},
+		{"await", columnReal, func(m *DiskIOMetric) interface{} { return &m.Await }},
+		{"utilization", columnReal, func(m *DiskIOMetric) interface{} { return &m.Utilization }},
+	},
+}
+
+// SetRates computes the derived values against the previous sample of the
+// device. Await is the time spent per completed request, as in iostat, and
+// utilization the share of the interval the device was busy.
+func (m *DiskIOMetric) SetRates(previous DiskIOMetric, elapsed time.Duration) {
+	m.ReadBytesRate = counterRate(previous.ReadBytes, m.ReadBytes, elapsed)
+	m.WriteBytesRate = counterRate(previous.WriteBytes, m.WriteBytes, elapsed)
+	m.ReadIOPS = counterRate(previous.ReadCount, m.ReadCount, elapsed)
+	m.WriteIOPS = counterRate(previous.WriteCount, m.WriteCount, elapsed)
+
+	reads := counterDelta(previous.ReadCount, m.ReadCount)
+	writes := counterDelta(previous.WriteCount, m.WriteCount)
+	readTime := counterDelta(previous.ReadTime, m.ReadTime)
+	writeTime := counterDelta(previous.WriteTime, m.WriteTime)
+
+	m.ReadAwait, m.WriteAwait, m.Await = 0, 0, 0
+	if reads > 0 {
+		m.ReadAwait = float64(readTime) / float64(reads)
+	}
+	if writes > 0 {
+		m.WriteAwait = float64(writeTime) / float64(writes)
+	}
+	if reads+writes > 0 {
+		m.Await = float64(readTime+writeTime) / float64(reads+writes)
+	}
+
+	m.Utilization = 0
+	if elapsed.Milliseconds() > 0 {
+		m.Utilization = float64(counterDelta(previous.IoTime, m.IoTime)) / float64(elapsed.Milliseconds()) * 100
+		if m.Utilization > 100 {
+			m.Utilization = 100
+		}
+	}
+}
+
+func (db *DB) SaveDiskIOMetrics(metrics []DiskIOMetric) error {
+	return diskIOTable.save(db, metrics)
+}
+
+// GetLastNDiskIOMetrics returns the last n collections; every device of a
+// collection is included
+func (db *DB) GetLastNDiskIOMetrics(devices []string, n int) ([]DiskIOMetric, error) {
+	return diskIOTable.lastN(db, devices, n)
+}
+
+func (db *DB) GetAllDiskIOMetrics(devices []string) ([]DiskIOMetric, error) {
+	return diskIOTable.all(db, devices)
+}
+
+func (db *DB) GetDiskIOMetricsInRange(devices []string, start, end time.Time) ([]DiskIOMetric, error) {
+	return diskIOTable.inRange(db, devices, start, end)
+}
+
+// GetBucketedDiskIOMetrics returns one sample per step and device
+func (db *DB) GetBucketedDiskIOMetrics(devices []string, q BucketQuery) ([]DiskIOMetric, error) {
+	return diskIOTable.bucketed(db, devices, q)
+}
@@ -0,0 +1,60 @@
+package database
+
+import "time"
+
+// DiskMetric is the usage of one mounted filesystem
+type DiskMetric struct {
+	Timestamp         string  `json:"timestamp"`
+	Mountpoint        string  `json:"mountpoint"`
+	Device            string  `json:"device"`
+	Fstype            string  `json:"fstype"`
+	Total             uint64  `json:"total"`
+	Used              uint64  `json:"used"`
+	Free              uint64  `json:"free"`
+	UsedPercent       float64 `json:"usedPercent"`
+	InodesTotal       uint64  `json:"inodesTotal"`
+	InodesUsed        uint64  `json:"inodesUsed"`
+	InodesFree        uint64  `json:"inodesFree"`
+	InodesUsedPercent float64 `json:"inodesUsedPercent"`
+}
+
+var diskTable = seriesTable[DiskMetric]{
+	name: "server_disk_metrics",
+	columns: []column[DiskMetric]{
+		{"timestamp", columnText, func(m *DiskMetric) interface{} { return &m.Timestamp }},
+		{"mountpoint", columnText, func(m *DiskMetric) interface{} { return &m.Mountpoint }},
+		{"device", columnText, func(m *DiskMetric) interface{} { return &m.Device }},
+		{"fstype", columnText, func(m *DiskMetric) interface{} { return &m.Fstype }},
+		{"total", columnInteger, func(m *DiskMetric) interface{} { return &m.Total }},
+		{"used", columnInteger, func(m *DiskMetric) interface{} { return &m.Used }},
+		{"free", columnInteger, func(m *DiskMetric) interface{} { return &m.Free }},
+		{"used_percent", columnReal, func(m *DiskMetric) interface{} { return &m.UsedPercent }},
+		{"inodes_total", columnInteger, func(m *DiskMetric) interface{} { return &m.InodesTotal }},
+		{"inodes_used", columnInteger, func(m *DiskMetric) interface{} { return &m.InodesUsed }},
+		{"inodes_free", columnInteger, func(m *DiskMetric) interface{} { return &m.InodesFree }},
+		{"inodes_used_percent", columnReal, func(m *DiskMetric) interface{} { return &m.InodesUsedPercent }},
+	},
+}
+
+func (db *DB) SaveDiskMetrics(metrics []DiskMetric) error {
+	return diskTable.save(db, metrics)
+}
+
+// GetLastNDiskMetrics returns the last n collections; every mountpoint of a
+// collection is included
+func (db *DB) GetLastNDiskMetrics(mountpoints []string, n int) ([]DiskMetric, error) {
+	return diskTable.lastN(db, mountpoints, n)
+}
+
+func (db *DB) GetAllDiskMetrics(mountpoints []string) ([]DiskMetric, error) {
+	return diskTable.all(db, mountpoints)
+}
+
+func (db *DB) GetDiskMetricsInRange(mountpoints []string, start, end time.Time) ([]DiskMetric, error) {
+	return diskTable.inRange(db, mountpoints, start, end)
+}
+
+// GetBucketedDiskMetrics returns one sample per step and mountpoint
+func (db *DB) GetBucketedDiskMetrics(mountpoints []string, q BucketQuery) ([]DiskMetric, error) {
+	return diskTable.bucketed(db, mountpoints, q)
+}
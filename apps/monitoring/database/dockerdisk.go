@@ -0,0 +1,195 @@
+package database
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Disk usage types, the categories of `docker system df`
+const (
+	DockerDiskImages     = "images"
+	DockerDiskContainers = "containers"
+	DockerDiskVolumes    = "volumes"
+	DockerDiskBuildCache = "buildCache"
+)
+
+// DockerDiskUsage is one category of `docker system df`. Reclaimable is what
+// a prune would free: unused images, stopped containers, volumes without
+// containers and build cache not in use.
+type DockerDiskUsage struct {
+	Timestamp   string `json:"timestamp"`
+	Type        string `json:"type"`
+	Count       int    `json:"count"`
+	Active      int    `json:"active"` // in use by a container, or running containers
+	Size        uint64 `json:"size"`   // bytes
+	Reclaimable uint64 `json:"reclaimable"`
+}
+
+// DockerDiskItem is an image, the writable layer of a container or a volume,
+// with the services and projects of the containers using it
+type DockerDiskItem struct {
+	Timestamp   string     `json:"timestamp"`
+	ID          string     `json:"id"` // image ID, container ID or volume name
+	Type        string     `json:"type"`
+	Name        string     `json:"name"`   // first tag, container name or volume name
+	Size        uint64     `json:"size"`   // bytes; for images, including the layers shared with other images
+	Shared      uint64     `json:"shared"` // bytes of the image layers shared with other images
+	Reclaimable uint64     `json:"reclaimable"`
+	Containers  int        `json:"containers"` // using the image or volume
+	Services    StringList `json:"services"`
+	Projects    StringList `json:"projects"`
+}
+
+// DockerDiskSnapshot is the disk usage and its breakdown at one collection
+type DockerDiskSnapshot struct {
+	Timestamp  string            `json:"timestamp"`
+	Usage      []DockerDiskUsage `json:"usage"`
+	Images     []DockerDiskItem  `json:"images"`
+	Containers []DockerDiskItem  `json:"containers"`
+	Volumes    []DockerDiskItem  `json:"volumes"`
+}
+
+// StringList is stored as a JSON array in a text column
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		l = StringList{}
+	}
+	content, err := json.Marshal([]string(l))
+	return string(content), err
+}
+
+func (l *StringList) Scan(src interface{}) error {
+	var content []byte
+	switch v := src.(type) {
+	case nil:
+		*l = StringList{}
+		return nil
+	case string:
+		content = []byte(v)
+	case []byte:
+		content = v
+	default:
+		return fmt.Errorf("cannot scan %T into a string list", src)
+	}
+	return json.Unmarshal(content, (*[]string)(l))
+}
+
+// Contains reports whether the list has the given value
+func (l StringList) Contains(value string) bool {
+	for _, item := range l {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+var dockerDiskTable = seriesTable[DockerDiskUsage]{
+	name: "docker_disk_usage",
+	columns: []column[DockerDiskUsage]{
+		{"timestamp", columnText, func(m *DockerDiskUsage) interface{} { return &m.Timestamp }},
+		{"type", columnText, func(m *DockerDiskUsage) interface{} { return &m.Type }},
+		{"count", columnInteger, func(m *DockerDiskUsage) interface{} { return &m.Count }},
+		{"active", columnInteger, func(m *DockerDiskUsage) interface{} { return &m.Active }},
+		{"size", columnInteger, func(m *DockerDiskUsage) interface{} { return &m.Size }},
+		{"reclaimable", columnInteger, func(m *DockerDiskUsage) interface{} { return &m.Reclaimable }},
+	},
+}
+
+var dockerDiskItemTable = seriesTable[DockerDiskItem]{
+	name: "docker_disk_items",
+	columns: []column[DockerDiskItem]{
+		{"timestamp", columnText, func(m *DockerDiskItem) interface{} { return &m.Timestamp }},
+		{"id", columnText, func(m *DockerDiskItem) interface{} { return &m.ID }},
+		{"type", columnText, func(m *DockerDiskItem) interface{} { return &m.Type }},
+		{"name", columnText, func(m *DockerDiskItem) interface{} { return &m.Name }},
+		{"size", columnInteger, func(m *DockerDiskItem) interface{} { return &m.Size }},
+		{"shared", columnInteger, func(m *DockerDiskItem) interface{} { return &m.Shared }},
+		{"reclaimable", columnInteger, func(m *DockerDiskItem) interface{} { return &m.Reclaimable }},
+		{"containers", columnInteger, func(m *DockerDiskItem) interface{} { return &m.Containers }},
+		{"services", columnText, func(m *DockerDiskItem) interface{} { return &m.Services }},
+		{"projects", columnText, func(m *DockerDiskItem) interface{} { return &m.Projects }},
+	},
+}
+
+// SaveDockerDiskUsage stores a collection in one transaction, so a snapshot
+// never has totals without their items
+func (db *DB) SaveDockerDiskUsage(usage []DockerDiskUsage, items []DockerDiskItem) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := dockerDiskTable.insert(tx, usage); err != nil {
+		return err
+	}
+	if err := dockerDiskItemTable.insert(tx, items); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetLastNDockerDiskUsage returns the last n collections; every type of a
+// collection is included
+func (db *DB) GetLastNDockerDiskUsage(types []string, n int) ([]DockerDiskUsage, error) {
+	return dockerDiskTable.lastN(db, types, n)
+}
+
+func (db *DB) GetAllDockerDiskUsage(types []string) ([]DockerDiskUsage, error) {
+	return dockerDiskTable.all(db, types)
+}
+
+func (db *DB) GetDockerDiskUsageInRange(types []string, start, end time.Time) ([]DockerDiskUsage, error) {
+	return dockerDiskTable.inRange(db, types, start, end)
+}
+
+// GetBucketedDockerDiskUsage returns one sample per step and type
+func (db *DB) GetBucketedDockerDiskUsage(types []string, q BucketQuery) ([]DockerDiskUsage, error) {
+	return dockerDiskTable.bucketed(db, types, q)
+}
+
+// GetDockerDiskSnapshot returns the last collection at or before at, or the
+// latest one when at is zero. With an appName only the items used by that
+// service or project are included, largest first. It returns nil when there
+// is none.
+func (db *DB) GetDockerDiskSnapshot(at time.Time, appName string) (*DockerDiskSnapshot, error) {
+	usage, err := dockerDiskTable.latestAt(db, at)
+	if err != nil || len(usage) == 0 {
+		return nil, err
+	}
+
+	timestamp := usage[0].Timestamp
+	items, err := dockerDiskItemTable.collection(db, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Size > items[j].Size })
+
+	snapshot := &DockerDiskSnapshot{
+		Timestamp:  timestamp,
+		Usage:      usage,
+		Images:     []DockerDiskItem{},
+		Containers: []DockerDiskItem{},
+		Volumes:    []DockerDiskItem{},
+	}
+	for _, item := range items {
+		if appName != "" && !item.Services.Contains(appName) && !item.Projects.Contains(appName) && item.Name != appName {
+			continue
+		}
+		switch item.Type {
+		case DockerDiskImages:
+			snapshot.Images = append(snapshot.Images, item)
+		case DockerDiskContainers:
+			snapshot.Containers = append(snapshot.Containers, item)
+		case DockerDiskVolumes:
+			snapshot.Volumes = append(snapshot.Volumes, item)
+		}
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSaveDockerDiskUsage(t *testing.T) {
+	db := newTestServerDB(t)
+
+	const timestamp = "2024-01-01T00:00:00Z"
+	usage := []DockerDiskUsage{{Timestamp: timestamp, Type: DockerDiskImages, Count: 1, Size: 600}}
+	items := []DockerDiskItem{{Timestamp: timestamp, ID: "sha256:img1", Type: DockerDiskImages, Size: 600}}
+	if err := db.SaveDockerDiskUsage(usage, items); err != nil {
+		t.Fatalf("SaveDockerDiskUsage: %v", err)
+	}
+
+	snapshot, err := db.GetDockerDiskSnapshot(time.Time{}, "")
+	if err != nil || snapshot == nil {
+		t.Fatalf("got %v (%v), want a snapshot", snapshot, err)
+	}
+	if len(snapshot.Usage) != 1 || len(snapshot.Images) != 1 || snapshot.Images[0].ID != "sha256:img1" {
+		t.Errorf("got %+v", snapshot)
+	}
+}
+
+func TestSaveDockerDiskUsageRollsBack(t *testing.T) {
+	db := newTestServerDB(t)
+
+	// The same item twice fails on the primary key after the totals were
+	// inserted
+	const timestamp = "2024-01-01T00:00:00Z"
+	usage := []DockerDiskUsage{{Timestamp: timestamp, Type: DockerDiskImages, Count: 1, Size: 600}}
+	item := DockerDiskItem{Timestamp: timestamp, ID: "sha256:img1", Type: DockerDiskImages, Size: 600}
+	if err := db.SaveDockerDiskUsage(usage, []DockerDiskItem{item, item}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if snapshot, err := db.GetDockerDiskSnapshot(time.Time{}, ""); err != nil || snapshot != nil {
+		t.Errorf("got %+v (%v), want no snapshot", snapshot, err)
+	}
+}
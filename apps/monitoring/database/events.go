@@ -0,0 +1,98 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ContainerEvent is a lifecycle event of a monitored container, read from
+// the Docker event stream as it happens
+type ContainerEvent struct {
+	Timestamp   string `json:"timestamp"`
+	ContainerID string `json:"containerId"`
+	Name        string `json:"name"`
+	Service     string `json:"service"`
+	Project     string `json:"project,omitempty"`
+	Action      string `json:"action"`             // start, die, oom, kill, health_status or restart
+	ExitCode    *int   `json:"exitCode,omitempty"` // die only
+	Signal      string `json:"signal,omitempty"`   // kill only
+	Health      string `json:"health,omitempty"`   // health_status only
+}
+
+func (db *DB) InitContainerEventsTable() error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS container_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			timestamp TEXT NOT NULL,
+			container_id TEXT NOT NULL,
+			container_name TEXT NOT NULL,
+			service_name TEXT,
+			project TEXT,
+			action TEXT NOT NULL,
+			exit_code INTEGER,
+			signal TEXT,
+			health TEXT
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating container_events table: %v", err)
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_container_events_timestamp ON container_events(timestamp)`)
+	if err != nil {
+		return fmt.Errorf("error creating timestamp index: %v", err)
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_container_events_service ON container_events(service_name)`)
+	if err != nil {
+		return fmt.Errorf("error creating service index: %v", err)
+	}
+
+	return nil
+}
+
+func (db *DB) SaveContainerEvent(event *ContainerEvent) error {
+	_, err := db.Exec(`
+		INSERT INTO container_events (timestamp, container_id, container_name, service_name, project, action, exit_code, signal, health)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, event.Timestamp, event.ContainerID, event.Name, event.Service, event.Project, event.Action, event.ExitCode, event.Signal, event.Health)
+	return err
+}
+
+// GetContainerEvents returns the events of an application between start and
+// end, matched like the container metrics
+func (db *DB) GetContainerEvents(appName string, start, end time.Time) ([]ContainerEvent, error) {
+	appName = strings.TrimPrefix(appName, "/")
+
+	rows, err := db.Query(`
+		SELECT timestamp, container_id, container_name, service_name, project, action, exit_code, signal, health
+		FROM container_events
+		WHERE (`+containerAppFilter+`)
+		AND timestamp BETWEEN ? AND ?
+		ORDER BY timestamp ASC, id ASC
+	`, append(containerAppArgs(appName), rangeStart(start), rangeEnd(end))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []ContainerEvent{}
+	for rows.Next() {
+		var event ContainerEvent
+		var service, project, signal, health sql.NullString
+		var exitCode sql.NullInt64
+		if err := rows.Scan(&event.Timestamp, &event.ContainerID, &event.Name, &service, &project, &event.Action, &exitCode, &signal, &health); err != nil {
+			return nil, err
+		}
+		event.Service, event.Project = service.String, project.String
+		event.Signal, event.Health = signal.String, health.String
+		if exitCode.Valid {
+			code := int(exitCode.Int64)
+			event.ExitCode = &code
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,86 @@
+package database
+
+import "time"
+
+// InterfaceMetric holds the counters of one host network interface, and
+// their rates per second since the previous sample
+type InterfaceMetric struct {
+	Timestamp   string `json:"timestamp"`
+	Interface   string `json:"interface"`
+	BytesRecv   uint64 `json:"bytesRecv"`
+	BytesSent   uint64 `json:"bytesSent"`
+	PacketsRecv uint64 `json:"packetsRecv"`
+	PacketsSent uint64 `json:"packetsSent"`
+	ErrIn       uint64 `json:"errIn"`
+	ErrOut      uint64 `json:"errOut"`
+	DropIn      uint64 `json:"dropIn"`
+	DropOut     uint64 `json:"dropOut"`
+
+	BytesRecvRate   float64 `json:"bytesRecvRate"`
+	BytesSentRate   float64 `json:"bytesSentRate"`
+	PacketsRecvRate float64 `json:"packetsRecvRate"`
+	PacketsSentRate float64 `json:"packetsSentRate"`
+	ErrInRate       float64 `json:"errInRate"`
+	ErrOutRate      float64 `json:"errOutRate"`
+	DropInRate      float64 `json:"dropInRate"`
+	DropOutRate     float64 `json:"dropOutRate"`
+}
+
+var interfaceTable = seriesTable[InterfaceMetric]{
+	name: "server_network_metrics",
+	columns: []column[InterfaceMetric]{
+		{"timestamp", columnText, func(m *InterfaceMetric) interface{} { return &m.Timestamp }},
+		{"interface", columnText, func(m *InterfaceMetric) interface{} { return &m.Interface }},
+		{"bytes_recv", columnInteger, func(m *InterfaceMetric) interface{} { return &m.BytesRecv }},
+		{"bytes_sent", columnInteger, func(m *InterfaceMetric) interface{} { return &m.BytesSent }},
+		{"packets_recv", columnInteger, func(m *InterfaceMetric) interface{} { return &m.PacketsRecv }},
+		{"packets_sent", columnInteger, func(m *InterfaceMetric) interface{} { return &m.PacketsSent }},
+		{"err_in", columnInteger, func(m *InterfaceMetric) interface{} { return &m.ErrIn }},
+		{"err_out", columnInteger, func(m *InterfaceMetric) interface{} { return &m.ErrOut }},
+		{"drop_in", columnInteger, func(m *InterfaceMetric) interface{} { return &m.DropIn }},
+		{"drop_out", columnInteger, func(m *InterfaceMetric) interface{} { return &m.DropOut }},
+		{"bytes_recv_rate", columnReal, func(m *InterfaceMetric) interface{} { return &m.BytesRecvRate }},
+		{"bytes_sent_rate", columnReal, func(m *InterfaceMetric) interface{} { return &m.BytesSentRate }},
+		{"packets_recv_rate", columnReal, func(m *InterfaceMetric) interface{} { return &m.PacketsRecvRate }},
+		{"packets_sent_rate", columnReal, func(m *InterfaceMetric) interface{} { return &m.PacketsSentRate }},
+		{"err_in_rate", columnReal, func(m *InterfaceMetric) interface{} { return &m.ErrInRate }},
+		{"err_out_rate", columnReal, func(m *InterfaceMetric) interface{} { return &m.ErrOutRate }},
+		{"drop_in_rate", columnReal, func(m *InterfaceMetric) interface{} { return &m.DropInRate }},
+		{"drop_out_rate", columnReal, func(m *InterfaceMetric) interface{} { return &m.DropOutRate }},
+	},
+}
+
+// SetRates computes the rates against the previous sample of the interface
+func (m *InterfaceMetric) SetRates(previous InterfaceMetric, elapsed time.Duration) {
+	m.BytesRecvRate = counterRate(previous.BytesRecv, m.BytesRecv, elapsed)
+	m.BytesSentRate = counterRate(previous.BytesSent, m.BytesSent, elapsed)
+	m.PacketsRecvRate = counterRate(previous.PacketsRecv, m.PacketsRecv, elapsed)
+	m.PacketsSentRate = counterRate(previous.PacketsSent, m.PacketsSent, elapsed)
+	m.ErrInRate = counterRate(previous.ErrIn, m.ErrIn, elapsed)
+	m.ErrOutRate = counterRate(previous.ErrOut, m.ErrOut, elapsed)
+	m.DropInRate = counterRate(previous.DropIn, m.DropIn, elapsed)
+	m.DropOutRate = counterRate(previous.DropOut, m.DropOut, elapsed)
+}
+
+func (db *DB) SaveInterfaceMetrics(metrics []InterfaceMetric) error {
+	return interfaceTable.save(db, metrics)
+}
+
+// GetLastNInterfaceMetrics returns the last n collections; every interface
+// of a collection is included
+func (db *DB) GetLastNInterfaceMetrics(interfaces []string, n int) ([]InterfaceMetric, error) {
+	return interfaceTable.lastN(db, interfaces, n)
+}
+
+func (db *DB) GetAllInterfaceMetrics(interfaces []string) ([]InterfaceMetric, error) {
+	return interfaceTable.all(db, interfaces)
+}
+
+func (db *DB) GetInterfaceMetricsInRange(interfaces []string, start, end time.Time) ([]InterfaceMetric, error) {
+	return interfaceTable.inRange(db, interfaces, start, end)
+}
+
+// GetBucketedInterfaceMetrics returns one sample per step and interface
+func (db *DB) GetBucketedInterfaceMetrics(interfaces []string, q BucketQuery) ([]InterfaceMetric, error) {
+	return interfaceTable.bucketed(db, interfaces, q)
+}
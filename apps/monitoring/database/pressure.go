@@ -0,0 +1,111 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PressureStall is one line of a pressure stall information (PSI) file: the
+// share of time tasks were stalled over the last 10, 60 and 300 seconds, and
+// the total stall time in microseconds
+type PressureStall struct {
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	Total  uint64  `json:"total"`
+}
+
+// PressureResource holds the "some" line (at least one task stalled) and the
+// "full" line (every non-idle task stalled) of a resource
+type PressureResource struct {
+	Some PressureStall `json:"some"`
+	Full PressureStall `json:"full"`
+}
+
+// PressureMetric is the PSI of the host or of a cgroup
+type PressureMetric struct {
+	CPU    PressureResource `json:"cpu"`
+	Memory PressureResource `json:"memory"`
+	IO     PressureResource `json:"io"`
+}
+
+// Resources returns the resources by the name used in the PSI file names
+func (p *PressureMetric) Resources() map[string]*PressureResource {
+	return map[string]*PressureResource{
+		"cpu":    &p.CPU,
+		"memory": &p.Memory,
+		"io":     &p.IO,
+	}
+}
+
+// ParsePressure reads the content of a PSI file such as /proc/pressure/io or
+// a cgroup io.pressure. Kernels before 5.13 have no "full" line for cpu.
+func ParsePressure(content string) (PressureResource, error) {
+	var resource PressureResource
+	for _, line := range strings.Split(strings.TrimSpace(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var stall *PressureStall
+		switch fields[0] {
+		case "some":
+			stall = &resource.Some
+		case "full":
+			stall = &resource.Full
+		default:
+			return resource, fmt.Errorf("unexpected pressure line %q", line)
+		}
+
+		for _, field := range fields[1:] {
+			key, value, found := strings.Cut(field, "=")
+			if !found {
+				return resource, fmt.Errorf("unexpected pressure field %q", field)
+			}
+			var err error
+			switch key {
+			case "avg10":
+				stall.Avg10, err = strconv.ParseFloat(value, 64)
+			case "avg60":
+				stall.Avg60, err = strconv.ParseFloat(value, 64)
+			case "avg300":
+				stall.Avg300, err = strconv.ParseFloat(value, 64)
+			case "total":
+				stall.Total, err = strconv.ParseUint(value, 10, 64)
+			}
+			if err != nil {
+				return resource, fmt.Errorf("error parsing pressure field %q: %v", field, err)
+			}
+		}
+	}
+	return resource, nil
+}
+
+// pressureColumns stores a PressureMetric as psi_<resource>_<line>_<field>
+// columns
+func pressureColumns[T any](pressure func(*T) *PressureMetric) []column[T] {
+	var columns []column[T]
+	for _, resource := range []string{"cpu", "memory", "io"} {
+		resource := resource
+		for _, line := range []string{"some", "full"} {
+			line := line
+			stall := func(m *T) *PressureStall {
+				r := pressure(m).Resources()[resource]
+				if line == "some" {
+					return &r.Some
+				}
+				return &r.Full
+			}
+			prefix := "psi_" + resource + "_" + line + "_"
+			columns = append(columns,
+				column[T]{prefix + "avg10", columnReal, func(m *T) interface{} { return &stall(m).Avg10 }},
+				column[T]{prefix + "avg60", columnReal, func(m *T) interface{} { return &stall(m).Avg60 }},
+				column[T]{prefix + "avg300", columnReal, func(m *T) interface{} { return &stall(m).Avg300 }},
+				column[T]{prefix + "total", columnInteger, func(m *T) interface{} { return &stall(m).Total }},
+			)
+		}
+	}
+	return columns
+}
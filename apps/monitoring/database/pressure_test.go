@@ -0,0 +1,69 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePressure(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    PressureResource
+		wantErr bool
+	}{
+		{
+			name:    "some and full",
+			content: "some avg10=1.25 avg60=0.50 avg300=0.10 total=123456\nfull avg10=0.75 avg60=0.25 avg300=0.05 total=65432\n",
+			want: PressureResource{
+				Some: PressureStall{Avg10: 1.25, Avg60: 0.5, Avg300: 0.1, Total: 123456},
+				Full: PressureStall{Avg10: 0.75, Avg60: 0.25, Avg300: 0.05, Total: 65432},
+			},
+		},
+		{
+			// cpu on kernels before 5.13
+			name:    "no full line",
+			content: "some avg10=2.00 avg60=1.00 avg300=0.50 total=9000\n",
+			want: PressureResource{
+				Some: PressureStall{Avg10: 2, Avg60: 1, Avg300: 0.5, Total: 9000},
+			},
+		},
+		{
+			name:    "empty",
+			content: "",
+		},
+		{
+			name:    "unknown line",
+			content: "partial avg10=0.00\n",
+			wantErr: true,
+		},
+		{
+			name:    "field without value",
+			content: "some avg10\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid number",
+			content: "some avg10=abc avg60=0.00 avg300=0.00 total=0\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePressure(tt.content)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePressure: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+// ProcessMetric is one process of a top-N snapshot. A process can be in the
+// top by CPU, by memory or both; its rank is 0 in a top it is not part of.
+type ProcessMetric struct {
+	Timestamp   string  `json:"timestamp"`
+	PID         int32   `json:"pid"`
+	Name        string  `json:"name"`
+	Cmdline     string  `json:"cmdline"`
+	User        string  `json:"user"`
+	ContainerID string  `json:"containerId,omitempty"`
+	CPU         float64 `json:"cpu"` // percent of one core since the previous snapshot
+	RSS         uint64  `json:"rss"`
+	Memory      float64 `json:"memory"` // percent of the host memory
+	CPURank     int     `json:"cpuRank"`
+	MemoryRank  int     `json:"memoryRank"`
+}
+
+// ProcessSnapshot is the top processes by CPU and by RSS at one collection
+type ProcessSnapshot struct {
+	Timestamp string          `json:"timestamp"`
+	CPU       []ProcessMetric `json:"cpu"`
+	Memory    []ProcessMetric `json:"memory"`
+}
+
+var processTable = seriesTable[ProcessMetric]{
+	name: "process_snapshots",
+	columns: []column[ProcessMetric]{
+		{"timestamp", columnText, func(m *ProcessMetric) interface{} { return &m.Timestamp }},
+		{"pid", columnInteger, func(m *ProcessMetric) interface{} { return &m.PID }},
+		{"name", columnText, func(m *ProcessMetric) interface{} { return &m.Name }},
+		{"cmdline", columnText, func(m *ProcessMetric) interface{} { return &m.Cmdline }},
+		{"user", columnText, func(m *ProcessMetric) interface{} { return &m.User }},
+		{"container_id", columnText, func(m *ProcessMetric) interface{} { return &m.ContainerID }},
+		{"cpu", columnReal, func(m *ProcessMetric) interface{} { return &m.CPU }},
+		{"rss", columnInteger, func(m *ProcessMetric) interface{} { return &m.RSS }},
+		{"memory", columnReal, func(m *ProcessMetric) interface{} { return &m.Memory }},
+		{"cpu_rank", columnInteger, func(m *ProcessMetric) interface{} { return &m.CPURank }},
+		{"memory_rank", columnInteger, func(m *ProcessMetric) interface{} { return &m.MemoryRank }},
+	},
+}
+
+// NewProcessSnapshot splits the processes of one collection into the top by
+// CPU and the top by memory, each ordered by rank
+func NewProcessSnapshot(timestamp string, processes []ProcessMetric) ProcessSnapshot {
+	snapshot := ProcessSnapshot{Timestamp: timestamp, CPU: []ProcessMetric{}, Memory: []ProcessMetric{}}
+	for _, p := range processes {
+		if p.CPURank > 0 {
+			snapshot.CPU = append(snapshot.CPU, p)
+		}
+		if p.MemoryRank > 0 {
+			snapshot.Memory = append(snapshot.Memory, p)
+		}
+	}
+	sort.Slice(snapshot.CPU, func(i, j int) bool { return snapshot.CPU[i].CPURank < snapshot.CPU[j].CPURank })
+	sort.Slice(snapshot.Memory, func(i, j int) bool { return snapshot.Memory[i].MemoryRank < snapshot.Memory[j].MemoryRank })
+	return snapshot
+}
+
+func (db *DB) SaveProcessMetrics(processes []ProcessMetric) error {
+	return processTable.save(db, processes)
+}
+
+// GetProcessSnapshot returns the last snapshot taken at or before at, or the
+// latest one when at is zero. It returns nil when there is none.
+func (db *DB) GetProcessSnapshot(at time.Time) (*ProcessSnapshot, error) {
+	processes, err := processTable.latestAt(db, at)
+	if err != nil || len(processes) == 0 {
+		return nil, err
+	}
+	snapshot := NewProcessSnapshot(processes[0].Timestamp, processes)
+	return &snapshot, nil
+}
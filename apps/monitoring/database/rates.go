@@ -0,0 +1,98 @@
+package database
+
+import (
+	"math"
+	"time"
+)
+
+// counterRate returns the per-second increase of a cumulative counter. A
+// counter lower than the previous one was reset (reboot, container restart)
+// and has counted from zero since.
+func counterRate(previous, current uint64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(counterDelta(previous, current)) / elapsed.Seconds()
+}
+
+func counterDelta(previous, current uint64) uint64 {
+	if current < previous {
+		return current
+	}
+	return current - previous
+}
+
+// SetRates computes the network, swap and disk I/O rates against the previous
+// sample of the host. The first sample has no previous one and keeps rates
+// at 0.
+func (m *ServerMetric) SetRates(previous *ServerMetric) {
+	if previous == nil {
+		return
+	}
+	current, err := time.Parse(time.RFC3339Nano, m.Timestamp)
+	if err != nil {
+		return
+	}
+	last, err := time.Parse(time.RFC3339Nano, previous.Timestamp)
+	if err != nil {
+		return
+	}
+
+	elapsed := current.Sub(last)
+	m.setNetworkRates(previous, elapsed)
+	m.SwapInRate = counterRate(previous.SwapIn, m.SwapIn, elapsed)
+	m.SwapOutRate = counterRate(previous.SwapOut, m.SwapOut, elapsed)
+
+	devices := make(map[string]DiskIOMetric, len(previous.DiskIO))
+	for _, device := range previous.DiskIO {
+		devices[device.Device] = device
+	}
+	for i := range m.DiskIO {
+		if prev, ok := devices[m.DiskIO[i].Device]; ok {
+			m.DiskIO[i].SetRates(prev, elapsed)
+		}
+	}
+}
+
+func (m *ServerMetric) setNetworkRates(previous *ServerMetric, elapsed time.Duration) {
+	if len(m.Interfaces) == 0 {
+		m.NetworkInRate = counterRate(previous.NetworkInBytes, m.NetworkInBytes, elapsed)
+		m.NetworkOutRate = counterRate(previous.NetworkOutBytes, m.NetworkOutBytes, elapsed)
+		return
+	}
+
+	// The totals are the sum of the interface rates, so an interface going
+	// away is not mistaken for a counter reset
+	interfaces := make(map[string]InterfaceMetric, len(previous.Interfaces))
+	for _, iface := range previous.Interfaces {
+		interfaces[iface.Interface] = iface
+	}
+	for i := range m.Interfaces {
+		iface := &m.Interfaces[i]
+		if prev, ok := interfaces[iface.Interface]; ok {
+			iface.SetRates(prev, elapsed)
+		}
+		m.NetworkInRate += iface.BytesRecvRate
+		m.NetworkOutRate += iface.BytesSentRate
+	}
+}
+
+// SetRates computes the container network rates against its previous sample
+func (n *NetworkMetric) SetRates(previous NetworkMetric, elapsed time.Duration) {
+	n.InputRate = counterRate(previous.InputBytes, n.InputBytes, elapsed)
+	n.OutputRate = counterRate(previous.OutputBytes, n.OutputBytes, elapsed)
+}
+
+// UseNetworkRates replaces the cumulative Input/Output of each sample by its
+// rate, rounded to bytes per second
+func UseNetworkRates(metrics []ContainerMetric) {
+	for i := range metrics {
+		network := &metrics[i].Network
+		network.Input = uint64(math.Round(network.InputRate))
+		network.Output = uint64(math.Round(network.OutputRate))
+	}
+}
+
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,207 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCounterRate(t *testing.T) {
+	tests := []struct {
+		name              string
+		previous, current uint64
+		elapsed           time.Duration
+		want              float64
+	}{
+		{"increase", 1000, 3000, 2 * time.Second, 1000},
+		{"unchanged", 3000, 3000, time.Second, 0},
+		// After a reset the counter has counted from zero
+		{"reset", 5000, 400, 2 * time.Second, 200},
+		{"zero interval", 1000, 3000, 0, 0},
+		{"negative interval", 1000, 3000, -time.Second, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := counterRate(tt.previous, tt.current, tt.elapsed); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCounterDelta(t *testing.T) {
+	if got := counterDelta(100, 250); got != 150 {
+		t.Errorf("got %d, want 150", got)
+	}
+	if got := counterDelta(250, 100); got != 100 {
+		t.Errorf("got %d after a reset, want 100", got)
+	}
+}
+
+func TestServerMetricSetRates(t *testing.T) {
+	previous := &ServerMetric{
+		Timestamp:       "2024-01-01T00:00:00Z",
+		NetworkInBytes:  1000,
+		NetworkOutBytes: 5000,
+		SwapIn:          10,
+		DiskIO: []DiskIOMetric{
+			{Device: "sda", ReadBytes: 4096, ReadCount: 10, ReadTime: 50, IoTime: 1000},
+		},
+	}
+	current := &ServerMetric{
+		Timestamp:       "2024-01-01T00:00:10Z",
+		NetworkInBytes:  11000,
+		NetworkOutBytes: 2000,
+		SwapIn:          30,
+		DiskIO: []DiskIOMetric{
+			{Device: "sda", ReadBytes: 45056, ReadCount: 30, ReadTime: 250, IoTime: 6000},
+			// No previous sample
+			{Device: "sdb", ReadBytes: 4096, ReadCount: 1},
+		},
+	}
+	current.SetRates(previous)
+
+	if current.NetworkInRate != 1000 || current.NetworkOutRate != 200 {
+		t.Errorf("got network rates %v and %v, want 1000 and 200 after the reset", current.NetworkInRate, current.NetworkOutRate)
+	}
+	if current.SwapInRate != 2 {
+		t.Errorf("got swap in rate %v, want 2", current.SwapInRate)
+	}
+
+	sda := current.DiskIO[0]
+	if sda.ReadBytesRate != 4096 || sda.ReadIOPS != 2 || sda.ReadAwait != 10 || sda.Await != 10 || sda.Utilization != 50 {
+		t.Errorf("got sda %+v", sda)
+	}
+	if sdb := current.DiskIO[1]; sdb.ReadBytesRate != 0 || sdb.ReadIOPS != 0 {
+		t.Errorf("got rates %+v for a device without a previous sample", sdb)
+	}
+}
+
+func TestServerMetricSetRatesInterfaces(t *testing.T) {
+	previous := &ServerMetric{
+		Timestamp: "2024-01-01T00:00:00Z",
+		Interfaces: []InterfaceMetric{
+			{Interface: "eth0", BytesRecv: 1000, BytesSent: 100},
+			{Interface: "eth1", BytesRecv: 1 << 30},
+		},
+	}
+	// eth1 went away: the totals only count eth0, with no reset
+	current := &ServerMetric{
+		Timestamp: "2024-01-01T00:00:02Z",
+		Interfaces: []InterfaceMetric{
+			{Interface: "eth0", BytesRecv: 3000, BytesSent: 500},
+		},
+		NetworkInBytes: 3000,
+	}
+	current.SetRates(previous)
+
+	if current.NetworkInRate != 1000 || current.NetworkOutRate != 200 {
+		t.Errorf("got network rates %v and %v, want 1000 and 200", current.NetworkInRate, current.NetworkOutRate)
+	}
+	if current.Interfaces[0].BytesRecvRate != 1000 {
+		t.Errorf("got eth0 rate %v, want 1000", current.Interfaces[0].BytesRecvRate)
+	}
+}
+
+func TestServerMetricSetRatesFirstSample(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous *ServerMetric
+	}{
+		{"no previous sample", nil},
+		{"same timestamp", &ServerMetric{Timestamp: "2024-01-01T00:00:10Z"}},
+		{"invalid timestamp", &ServerMetric{Timestamp: "yesterday"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := &ServerMetric{Timestamp: "2024-01-01T00:00:10Z", NetworkInBytes: 1000, SwapOut: 10}
+			current.SetRates(tt.previous)
+			if current.NetworkInRate != 0 || current.SwapOutRate != 0 {
+				t.Errorf("got rates %v and %v, want 0", current.NetworkInRate, current.SwapOutRate)
+			}
+		})
+	}
+}
+
+func TestNetworkMetricSetRates(t *testing.T) {
+	current := NetworkMetric{InputBytes: 3000, OutputBytes: 100}
+	current.SetRates(NetworkMetric{InputBytes: 1000, OutputBytes: 900}, 4*time.Second)
+	// The container restarted and its output counter with it
+	if current.InputRate != 500 || current.OutputRate != 25 {
+		t.Errorf("got rates %v and %v, want 500 and 25", current.InputRate, current.OutputRate)
+	}
+}
+
+func TestBackfillNetworkRates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "monitoring.db")
+
+	// Rows written by a version storing the counters in MB only
+	legacy, err := sql.Open(driverName, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = legacy.Exec(`
+		CREATE TABLE server_metrics (
+			timestamp TEXT PRIMARY KEY, cpu REAL, cpu_model TEXT, cpu_cores INTEGER,
+			cpu_physical_cores INTEGER, cpu_speed REAL, os TEXT, distro TEXT, kernel TEXT,
+			arch TEXT, mem_used REAL, mem_used_gb REAL, mem_total REAL, uptime INTEGER,
+			disk_used REAL, total_disk REAL, network_in REAL, network_out REAL
+		);
+		INSERT INTO server_metrics VALUES
+			('2024-01-01T00:00:00Z', 1, 'cpu', 2, 1, 2.4, 'linux', 'debian', '6.1', 'x64', 10, 1, 8, 100, 20, 50, 10, 20),
+			('2024-01-01T00:00:10Z', 1, 'cpu', 2, 1, 2.4, 'linux', 'debian', '6.1', 'x64', 10, 1, 8, 110, 20, 50, 20, 20),
+			('2024-01-01T00:00:20Z', 1, 'cpu', 2, 1, 2.4, 'linux', 'debian', '6.1', 'x64', 10, 1, 8, 5, 20, 50, 5, 30);
+	`)
+	legacy.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := openDB(path)
+	if err != nil {
+		t.Fatalf("openDB: %v", err)
+	}
+	defer db.Close()
+
+	metrics, err := db.GetAllMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 3 {
+		t.Fatalf("got %d metrics, want 3", len(metrics))
+	}
+	want := []struct{ in, out float64 }{
+		{0, 0},
+		{1048576, 0},
+		// Rebooted: 5 MB since the reset
+		{524288, 1048576},
+	}
+	for i, w := range want {
+		if metrics[i].NetworkInRate != w.in || metrics[i].NetworkOutRate != w.out {
+			t.Errorf("%s: got rates %v and %v, want %v and %v",
+				metrics[i].Timestamp, metrics[i].NetworkInRate, metrics[i].NetworkOutRate, w.in, w.out)
+		}
+	}
+	if metrics[2].NetworkInBytes != 5*1048576 {
+		t.Errorf("got %d bytes in, want 5 MB", metrics[2].NetworkInBytes)
+	}
+
+	// Later samples are not backfilled again
+	if err := db.SaveMetric(ServerMetric{Timestamp: "2024-01-01T00:00:30Z", NetworkInRate: 7}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.migrateServerMetrics(); err != nil {
+		t.Fatalf("migrateServerMetrics: %v", err)
+	}
+	var legacyRows int
+	if err := db.QueryRow(`SELECT count(*) FROM server_metrics WHERE network_in IS NOT NULL`).Scan(&legacyRows); err != nil {
+		t.Fatal(err)
+	}
+	if legacyRows != 0 {
+		t.Errorf("got %d rows left to backfill", legacyRows)
+	}
+	if last, err := db.GetLastNMetrics(1); err != nil || len(last) != 1 || last[0].NetworkInRate != 7 {
+		t.Errorf("got %+v (%v), want the saved rate", last, err)
+	}
+}
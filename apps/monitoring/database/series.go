@@ -0,0 +1,226 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// seriesTable stores one row per collection and key, such as a network
+// interface or a mountpoint. The first column is the timestamp and the
+// second one the key.
+type seriesTable[T any] struct {
+	name    string
+	columns []column[T]
+}
+
+func (t seriesTable[T]) key() string {
+	return t.columns[1].name
+}
+
+func (t seriesTable[T]) init(db *DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS ` + t.name + ` (
+			` + columnDefinitions(t.columns) + `,
+			PRIMARY KEY (timestamp, ` + t.key() + `)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating %s table: %v", t.name, err)
+	}
+	return migrateColumns(db, t.name, t.columns)
+}
+
+func (t seriesTable[T]) save(db *DB, metrics []T) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := t.insert(tx, metrics); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insert adds the rows within a transaction, for collections spanning
+// several tables
+func (t seriesTable[T]) insert(tx *sql.Tx, metrics []T) error {
+	for i := range metrics {
+		_, err := tx.Exec(`
+			INSERT INTO `+t.name+` (`+columnNames(t.columns)+`)
+			VALUES (`+columnPlaceholders(t.columns)+`)
+		`, columnValues(t.columns, &metrics[i])...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keyFilter restricts a query to the given keys; an empty list matches
+// every key
+func (t seriesTable[T]) keyFilter(keys []string) (string, []interface{}) {
+	if len(keys) == 0 {
+		return "1 = 1", nil
+	}
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	return t.key() + " IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(keys)), ", ") + ")", args
+}
+
+// lastN returns the last n collections; every key of a collection is included
+func (t seriesTable[T]) lastN(db *DB, keys []string, n int) ([]T, error) {
+	filter, filterArgs := t.keyFilter(keys)
+	var args []interface{}
+	args = append(args, filterArgs...)
+	args = append(args, filterArgs...)
+	args = append(args, n)
+
+	rows, err := db.Query(`
+		SELECT `+columnNames(t.columns)+`
+		FROM `+t.name+`
+		WHERE `+filter+` AND timestamp IN (
+			SELECT DISTINCT timestamp
+			FROM `+t.name+`
+			WHERE `+filter+`
+			ORDER BY timestamp DESC
+			LIMIT ?
+		)
+		ORDER BY timestamp ASC, `+t.key()+` ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return t.scan(rows)
+}
+
+func (t seriesTable[T]) all(db *DB, keys []string) ([]T, error) {
+	filter, args := t.keyFilter(keys)
+	rows, err := db.Query(`
+		SELECT `+columnNames(t.columns)+`
+		FROM `+t.name+`
+		WHERE `+filter+`
+		ORDER BY timestamp ASC, `+t.key()+` ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return t.scan(rows)
+}
+
+func (t seriesTable[T]) inRange(db *DB, keys []string, start, end time.Time) ([]T, error) {
+	filter, args := t.keyFilter(keys)
+	rows, err := db.Query(`
+		SELECT `+columnNames(t.columns)+`
+		FROM `+t.name+`
+		WHERE `+filter+` AND timestamp BETWEEN ? AND ?
+		ORDER BY timestamp ASC, `+t.key()+` ASC
+	`, append(args, rangeStart(start), rangeEnd(end))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return t.scan(rows)
+}
+
+// latestAt returns every key of the last collection at or before at, or of
+// the last collection when at is zero
+func (t seriesTable[T]) latestAt(db *DB, at time.Time) ([]T, error) {
+	filter, args := "1 = 1", []interface{}(nil)
+	if !at.IsZero() {
+		filter, args = "timestamp <= ?", []interface{}{rangeEnd(at)}
+	}
+	rows, err := db.Query(`
+		SELECT `+columnNames(t.columns)+`
+		FROM `+t.name+`
+		WHERE timestamp = (
+			SELECT max(timestamp) FROM `+t.name+` WHERE `+filter+`
+		)
+		ORDER BY `+t.key()+` ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return t.scan(rows)
+}
+
+// collection returns every key stored with the given timestamp
+func (t seriesTable[T]) collection(db *DB, timestamp string) ([]T, error) {
+	rows, err := db.Query(`
+		SELECT `+columnNames(t.columns)+`
+		FROM `+t.name+`
+		WHERE timestamp = ?
+		ORDER BY `+t.key()+` ASC
+	`, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return t.scan(rows)
+}
+
+// bucketed returns one sample per step and key
+func (t seriesTable[T]) bucketed(db *DB, keys []string, q BucketQuery) ([]T, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+
+	selects := bucketSelects(t.columns[1:], q)
+	filter, filterArgs := t.keyFilter(keys)
+	rangeFilter, rangeArgs := q.rangeFilter()
+	step := int64(q.Step / time.Second)
+	args := []interface{}{step, step}
+	args = append(args, filterArgs...)
+	args = append(args, rangeArgs...)
+
+	rows, err := db.Query(`
+		SELECT `+strings.Join(selects, ", ")+`
+		FROM `+t.name+`
+		WHERE `+filter+` AND `+rangeFilter+`
+		GROUP BY bucket, `+t.key()+`
+		ORDER BY bucket ASC, `+t.key()+` ASC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var metrics []T
+	for rows.Next() {
+		var m T
+		var bucket int64
+		var lastTimestamp string
+		targets := append([]interface{}{&bucket, &lastTimestamp}, scanTargets(t.columns, &m)[1:]...)
+		if err := rows.Scan(targets...); err != nil {
+			return nil, err
+		}
+		*t.columns[0].field(&m).(*string) = bucketTimestamp(bucket)
+		metrics = append(metrics, m)
+	}
+	return metrics, rows.Err()
+}
+
+func (t seriesTable[T]) scan(rows *sql.Rows) ([]T, error) {
+	var metrics []T
+	for rows.Next() {
+		var m T
+		if err := rows.Scan(scanTargets(t.columns, &m)...); err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, rows.Err()
+}
@@ -1,6 +1,8 @@
 package database
 
 import (
+	"database/sql"
+	"fmt"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -23,8 +25,187 @@ type ServerMetric struct {
 	Uptime           uint64  `json:"uptime"`
 	DiskUsed         float64 `json:"diskUsed"`
 	TotalDisk        float64 `json:"totalDisk"`
-	NetworkIn        float64 `json:"networkIn"`
-	NetworkOut       float64 `json:"networkOut"`
+
+	// Network counters are the bytes transferred since boot; the rates are
+	// bytes per second since the previous sample
+	NetworkInBytes  uint64  `json:"networkInBytes"`
+	NetworkOutBytes uint64  `json:"networkOutBytes"`
+	NetworkInRate   float64 `json:"networkInRate"`
+	NetworkOutRate  float64 `json:"networkOutRate"`
+
+	// Share of the CPU time spent in each state over the sampling interval
+	CPUUser    float64 `json:"cpuUser"`
+	CPUSystem  float64 `json:"cpuSystem"`
+	CPUNice    float64 `json:"cpuNice"`
+	CPUIowait  float64 `json:"cpuIowait"`
+	CPUSteal   float64 `json:"cpuSteal"`
+	CPUIrq     float64 `json:"cpuIrq"`
+	CPUSoftirq float64 `json:"cpuSoftirq"`
+
+	// Load averages, and the same divided by the number of logical cores
+	Load1         float64 `json:"load1"`
+	Load5         float64 `json:"load5"`
+	Load15        float64 `json:"load15"`
+	Load1PerCore  float64 `json:"load1PerCore"`
+	Load5PerCore  float64 `json:"load5PerCore"`
+	Load15PerCore float64 `json:"load15PerCore"`
+
+	// Memory breakdown in bytes
+	MemAvailable uint64 `json:"memAvailable"`
+	MemBuffers   uint64 `json:"memBuffers"`
+	MemCached    uint64 `json:"memCached"`
+	MemShared    uint64 `json:"memShared"`
+	MemDirty     uint64 `json:"memDirty"`
+	MemWriteback uint64 `json:"memWriteback"`
+
+	// Swap usage in bytes. SwapIn/SwapOut are the bytes paged since boot and
+	// their rates the bytes per second since the previous sample.
+	SwapTotal       uint64  `json:"swapTotal"`
+	SwapUsed        uint64  `json:"swapUsed"`
+	SwapUsedPercent float64 `json:"swapUsedPercent"`
+	SwapIn          uint64  `json:"swapIn"`
+	SwapOut         uint64  `json:"swapOut"`
+	SwapInRate      float64 `json:"swapInRate"`
+	SwapOutRate     float64 `json:"swapOutRate"`
+
+	// Pressure stall information, zero on kernels without PSI
+	Pressure PressureMetric `json:"pressure"`
+
+	// Per-interface, per-mountpoint, per-device and per-core samples and the
+	// top processes are stored in their own tables
+	Interfaces []InterfaceMetric `json:"interfaces,omitempty"`
+	Disks      []DiskMetric      `json:"disks,omitempty"`
+	DiskIO     []DiskIOMetric    `json:"diskIO,omitempty"`
+	Cores      []CPUCoreMetric   `json:"cores,omitempty"`
+	Processes  []ProcessMetric   `json:"processes,omitempty"`
+}
+
+// serverColumns lists the server_metrics columns and the ServerMetric field
+// each one is stored in. Inserts, selects, bucketing and migrations are all
+// built from this list.
+var serverColumns = []column[ServerMetric]{
+	{"timestamp", columnText, func(m *ServerMetric) interface{} { return &m.Timestamp }},
+	{"cpu", columnReal, func(m *ServerMetric) interface{} { return &m.CPU }},
+	{"cpu_model", columnText, func(m *ServerMetric) interface{} { return &m.CPUModel }},
+	{"cpu_cores", columnInteger, func(m *ServerMetric) interface{} { return &m.CPUCores }},
+	{"cpu_physical_cores", columnInteger, func(m *ServerMetric) interface{} { return &m.CPUPhysicalCores }},
+	{"cpu_speed", columnReal, func(m *ServerMetric) interface{} { return &m.CPUSpeed }},
+	{"os", columnText, func(m *ServerMetric) interface{} { return &m.OS }},
+	{"distro", columnText, func(m *ServerMetric) interface{} { return &m.Distro }},
+	{"kernel", columnText, func(m *ServerMetric) interface{} { return &m.Kernel }},
+	{"arch", columnText, func(m *ServerMetric) interface{} { return &m.Arch }},
+	{"mem_used", columnReal, func(m *ServerMetric) interface{} { return &m.MemUsed }},
+	{"mem_used_gb", columnReal, func(m *ServerMetric) interface{} { return &m.MemUsedGB }},
+	{"mem_total", columnReal, func(m *ServerMetric) interface{} { return &m.MemTotal }},
+	{"uptime", columnInteger, func(m *ServerMetric) interface{} { return &m.Uptime }},
+	{"disk_used", columnReal, func(m *ServerMetric) interface{} { return &m.DiskUsed }},
+	{"total_disk", columnReal, func(m *ServerMetric) interface{} { return &m.TotalDisk }},
+	{"network_in_bytes", columnInteger, func(m *ServerMetric) interface{} { return &m.NetworkInBytes }},
+	{"network_out_bytes", columnInteger, func(m *ServerMetric) interface{} { return &m.NetworkOutBytes }},
+	{"network_in_rate", columnReal, func(m *ServerMetric) interface{} { return &m.NetworkInRate }},
+	{"network_out_rate", columnReal, func(m *ServerMetric) interface{} { return &m.NetworkOutRate }},
+	{"cpu_user", columnReal, func(m *ServerMetric) interface{} { return &m.CPUUser }},
+	{"cpu_system", columnReal, func(m *ServerMetric) interface{} { return &m.CPUSystem }},
+	{"cpu_nice", columnReal, func(m *ServerMetric) interface{} { return &m.CPUNice }},
+	{"cpu_iowait", columnReal, func(m *ServerMetric) interface{} { return &m.CPUIowait }},
+	{"cpu_steal", columnReal, func(m *ServerMetric) interface{} { return &m.CPUSteal }},
+	{"cpu_irq", columnReal, func(m *ServerMetric) interface{} { return &m.CPUIrq }},
+	{"cpu_softirq", columnReal, func(m *ServerMetric) interface{} { return &m.CPUSoftirq }},
+	{"load1", columnReal, func(m *ServerMetric) interface{} { return &m.Load1 }},
+	{"load5", columnReal, func(m *ServerMetric) interface{} { return &m.Load5 }},
+	{"load15", columnReal, func(m *ServerMetric) interface{} { return &m.Load15 }},
+	{"load1_per_core", columnReal, func(m *ServerMetric) interface{} { return &m.Load1PerCore }},
+	{"load5_per_core", columnReal, func(m *ServerMetric) interface{} { return &m.Load5PerCore }},
+	{"load15_per_core", columnReal, func(m *ServerMetric) interface{} { return &m.Load15PerCore }},
+	{"mem_available", columnInteger, func(m *ServerMetric) interface{} { return &m.MemAvailable }},
+	{"mem_buffers", columnInteger, func(m *ServerMetric) interface{} { return &m.MemBuffers }},
+	{"mem_cached", columnInteger, func(m *ServerMetric) interface{} { return &m.MemCached }},
+	{"mem_shared", columnInteger, func(m *ServerMetric) interface{} { return &m.MemShared }},
+	{"mem_dirty", columnInteger, func(m *ServerMetric) interface{} { return &m.MemDirty }},
+	{"mem_writeback", columnInteger, func(m *ServerMetric) interface{} { return &m.MemWriteback }},
+	{"swap_total", columnInteger, func(m *ServerMetric) interface{} { return &m.SwapTotal }},
+	{"swap_used", columnInteger, func(m *ServerMetric) interface{} { return &m.SwapUsed }},
+	{"swap_used_percent", columnReal, func(m *ServerMetric) interface{} { return &m.SwapUsedPercent }},
+	{"swap_in", columnInteger, func(m *ServerMetric) interface{} { return &m.SwapIn }},
+	{"swap_out", columnInteger, func(m *ServerMetric) interface{} { return &m.SwapOut }},
+	{"swap_in_rate", columnReal, func(m *ServerMetric) interface{} { return &m.SwapInRate }},
+	{"swap_out_rate", columnReal, func(m *ServerMetric) interface{} { return &m.SwapOutRate }},
+}
+
+func init() {
+	serverColumns = append(serverColumns, pressureColumns(func(m *ServerMetric) *PressureMetric { return &m.Pressure })...)
+}
+
+// migrateServerMetrics adds the columns introduced after the table was created
+func (db *DB) migrateServerMetrics() error {
+	if err := migrateColumns(db, "server_metrics", serverColumns); err != nil {
+		return err
+	}
+
+	// Older versions only stored the network counters in MB (network_in and
+	// network_out, no longer written)
+	_, err := db.Exec(`
+		UPDATE server_metrics
+		SET network_in_bytes = CAST(network_in * 1048576 AS INTEGER),
+			network_out_bytes = CAST(network_out * 1048576 AS INTEGER)
+		WHERE network_in IS NOT NULL AND network_in_bytes = 0
+	`)
+	if err != nil {
+		return fmt.Errorf("error migrating network counters: %v", err)
+	}
+	return db.backfillNetworkRates()
+}
+
+// backfillNetworkRates computes the network rates of the rows written by
+// older versions from their consecutive counters, then clears network_in and
+// network_out so they are only backfilled once
+func (db *DB) backfillNetworkRates() error {
+	rows, err := db.Query(`
+		SELECT timestamp, network_in_bytes, network_out_bytes
+		FROM server_metrics
+		WHERE network_in IS NOT NULL
+		ORDER BY timestamp ASC
+	`)
+	if err != nil {
+		return fmt.Errorf("error reading network counters: %v", err)
+	}
+	var metrics []ServerMetric
+	for rows.Next() {
+		var m ServerMetric
+		if err := rows.Scan(&m.Timestamp, &m.NetworkInBytes, &m.NetworkOutBytes); err != nil {
+			rows.Close()
+			return err
+		}
+		metrics = append(metrics, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i := range metrics {
+		if i > 0 {
+			metrics[i].SetRates(&metrics[i-1])
+		}
+		_, err := tx.Exec(`
+			UPDATE server_metrics
+			SET network_in_rate = ?, network_out_rate = ?, network_in = NULL, network_out = NULL
+			WHERE timestamp = ?
+		`, metrics[i].NetworkInRate, metrics[i].NetworkOutRate, metrics[i].Timestamp)
+		if err != nil {
+			return fmt.Errorf("error backfilling network rates: %v", err)
+		}
+	}
+	return tx.Commit()
 }
 
 func (db *DB) SaveMetric(metric ServerMetric) error {
@@ -33,40 +214,31 @@ func (db *DB) SaveMetric(metric ServerMetric) error {
 	}
 
 	_, err := db.Exec(`
-		INSERT INTO server_metrics (timestamp, cpu, cpu_model, cpu_cores, cpu_physical_cores, cpu_speed, os, distro, kernel, arch, mem_used, mem_used_gb, mem_total, uptime, disk_used, total_disk, network_in, network_out)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, metric.Timestamp, metric.CPU, metric.CPUModel, metric.CPUCores, metric.CPUPhysicalCores, metric.CPUSpeed, metric.OS, metric.Distro, metric.Kernel, metric.Arch, metric.MemUsed, metric.MemUsedGB, metric.MemTotal, metric.Uptime, metric.DiskUsed, metric.TotalDisk, metric.NetworkIn, metric.NetworkOut)
+		INSERT INTO server_metrics (`+columnNames(serverColumns)+`)
+		VALUES (`+columnPlaceholders(serverColumns)+`)
+	`, columnValues(serverColumns, &metric)...)
 	return err
 }
 
 func (db *DB) GetMetricsInRange(start, end time.Time) ([]ServerMetric, error) {
 	rows, err := db.Query(`
-		SELECT timestamp, cpu, cpu_model, cpu_cores, cpu_physical_cores, cpu_speed, os, distro, kernel, arch, mem_used, mem_used_gb, mem_total, uptime, disk_used, total_disk, network_in, network_out
+		SELECT `+columnNames(serverColumns)+`
 		FROM server_metrics
 		WHERE timestamp BETWEEN ? AND ?
 		ORDER BY timestamp ASC
-	`, start.UTC().Format(time.RFC3339Nano), end.UTC().Format(time.RFC3339Nano))
+	`, rangeStart(start), rangeEnd(end))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var metrics []ServerMetric
-	for rows.Next() {
-		var m ServerMetric
-		err := rows.Scan(&m.Timestamp, &m.CPU, &m.CPUModel, &m.CPUCores, &m.CPUPhysicalCores, &m.CPUSpeed, &m.OS, &m.Distro, &m.Kernel, &m.Arch, &m.MemUsed, &m.MemUsedGB, &m.MemTotal, &m.Uptime, &m.DiskUsed, &m.TotalDisk, &m.NetworkIn, &m.NetworkOut)
-		if err != nil {
-			return nil, err
-		}
-		metrics = append(metrics, m)
-	}
-	return metrics, nil
+	return scanServerMetrics(rows)
 }
 
 func (db *DB) GetLastNMetrics(n int) ([]ServerMetric, error) {
 	rows, err := db.Query(`
 		WITH recent_metrics AS (
-			SELECT timestamp, cpu, cpu_model, cpu_cores, cpu_physical_cores, cpu_speed, os, distro, kernel, arch, mem_used, mem_used_gb, mem_total, uptime, disk_used, total_disk, network_in, network_out
+			SELECT `+columnNames(serverColumns)+`
 			FROM server_metrics
 			ORDER BY timestamp DESC
 			LIMIT ?
@@ -79,21 +251,12 @@ func (db *DB) GetLastNMetrics(n int) ([]ServerMetric, error) {
 	}
 	defer rows.Close()
 
-	var metrics []ServerMetric
-	for rows.Next() {
-		var m ServerMetric
-		err := rows.Scan(&m.Timestamp, &m.CPU, &m.CPUModel, &m.CPUCores, &m.CPUPhysicalCores, &m.CPUSpeed, &m.OS, &m.Distro, &m.Kernel, &m.Arch, &m.MemUsed, &m.MemUsedGB, &m.MemTotal, &m.Uptime, &m.DiskUsed, &m.TotalDisk, &m.NetworkIn, &m.NetworkOut)
-		if err != nil {
-			return nil, err
-		}
-		metrics = append(metrics, m)
-	}
-	return metrics, nil
+	return scanServerMetrics(rows)
 }
 
 func (db *DB) GetAllMetrics() ([]ServerMetric, error) {
 	rows, err := db.Query(`
-		SELECT timestamp, cpu, cpu_model, cpu_cores, cpu_physical_cores, cpu_speed, os, distro, kernel, arch, mem_used, mem_used_gb, mem_total, uptime, disk_used, total_disk, network_in, network_out
+		SELECT ` + columnNames(serverColumns) + `
 		FROM server_metrics
 		ORDER BY timestamp ASC
 	`)
@@ -102,14 +265,18 @@ func (db *DB) GetAllMetrics() ([]ServerMetric, error) {
 	}
 	defer rows.Close()
 
+	return scanServerMetrics(rows)
+}
+
+func scanServerMetrics(rows *sql.Rows) ([]ServerMetric, error) {
 	var metrics []ServerMetric
 	for rows.Next() {
 		var m ServerMetric
-		err := rows.Scan(&m.Timestamp, &m.CPU, &m.CPUModel, &m.CPUCores, &m.CPUPhysicalCores, &m.CPUSpeed, &m.OS, &m.Distro, &m.Kernel, &m.Arch, &m.MemUsed, &m.MemUsedGB, &m.MemTotal, &m.Uptime, &m.DiskUsed, &m.TotalDisk, &m.NetworkIn, &m.NetworkOut)
+		err := rows.Scan(scanTargets(serverColumns, &m)...)
 		if err != nil {
 			return nil, err
 		}
 		metrics = append(metrics, m)
 	}
-	return metrics, nil
+	return metrics, rows.Err()
 }
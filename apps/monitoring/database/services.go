@@ -0,0 +1,77 @@
+package database
+
+import "sort"
+
+// ServiceMetric is the aggregate of every replica of a service sampled in
+// the same collection. Memory, network and block IO values are in bytes;
+// network values are bytes per second unless raw counters were requested.
+type ServiceMetric struct {
+	Timestamp  string          `json:"timestamp"`
+	Service    string          `json:"Service"`
+	Replicas   int             `json:"Replicas"`
+	CPU        AggregatedValue `json:"CPU"`
+	Memory     AggregatedValue `json:"Memory"`
+	NetworkIn  AggregatedValue `json:"NetworkIn"`
+	NetworkOut AggregatedValue `json:"NetworkOut"`
+	BlockRead  AggregatedValue `json:"BlockRead"`
+	BlockWrite AggregatedValue `json:"BlockWrite"`
+}
+
+type AggregatedValue struct {
+	Sum float64 `json:"sum"`
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+	Avg float64 `json:"avg"`
+}
+
+func (a *AggregatedValue) add(value float64, count int) {
+	if count == 1 || value < a.Min {
+		a.Min = value
+	}
+	if count == 1 || value > a.Max {
+		a.Max = value
+	}
+	a.Sum += value
+	a.Avg = a.Sum / float64(count)
+}
+
+// AggregateByService groups replica samples by collection timestamp and service
+func AggregateByService(metrics []ContainerMetric) []ServiceMetric {
+	type key struct{ timestamp, service string }
+
+	groups := make(map[key]*ServiceMetric)
+	var order []key
+
+	for _, m := range metrics {
+		service := m.Service
+		if service == "" {
+			service = m.Name
+		}
+
+		k := key{m.Timestamp, service}
+		agg, ok := groups[k]
+		if !ok {
+			agg = &ServiceMetric{Timestamp: m.Timestamp, Service: service}
+			groups[k] = agg
+			order = append(order, k)
+		}
+
+		agg.Replicas++
+		agg.CPU.add(m.CPU, agg.Replicas)
+		agg.Memory.add(float64(m.Memory.Used), agg.Replicas)
+		agg.NetworkIn.add(float64(m.Network.Input), agg.Replicas)
+		agg.NetworkOut.add(float64(m.Network.Output), agg.Replicas)
+		agg.BlockRead.add(float64(m.BlockIO.Read), agg.Replicas)
+		agg.BlockWrite.add(float64(m.BlockIO.Write), agg.Replicas)
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return order[i].timestamp < order[j].timestamp
+	})
+
+	result := make([]ServiceMetric, 0, len(order))
+	for _, k := range order {
+		result = append(result, *groups[k])
+	}
+	return result
+}
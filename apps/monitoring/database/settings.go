@@ -0,0 +1,43 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const runtimeConfigKey = "runtime"
+
+func (db *DB) InitRuntimeConfigTable() error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS runtime_config (
+			key TEXT PRIMARY KEY,
+			value_json TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating runtime_config table: %v", err)
+	}
+	return nil
+}
+
+// GetRuntimeConfig returns the settings stored through the API, or "" when
+// nothing was changed yet
+func (db *DB) GetRuntimeConfig() (string, error) {
+	var value string
+	err := db.QueryRow(`SELECT value_json FROM runtime_config WHERE key = ?`, runtimeConfigKey).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return value, err
+}
+
+func (db *DB) SaveRuntimeConfig(valueJSON string) error {
+	_, err := db.Exec(`
+		INSERT INTO runtime_config (key, value_json, updated_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET value_json = excluded.value_json, updated_at = excluded.updated_at
+	`, runtimeConfigKey, valueJSON, time.Now().UTC().Format(time.RFC3339Nano))
+	return err
+}
@@ -0,0 +1,195 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// NewMemoryMetric returns the memory usage of a container against its limit
+func NewMemoryMetric(used, limit uint64) MemoryMetric {
+	var percentage float64
+	if limit > 0 {
+		percentage = round2(float64(used) / float64(limit) * 100)
+	}
+	return MemoryMetric{Percentage: percentage, Used: used, Total: limit}
+}
+
+// NewNetworkMetric returns the cumulative network counters of a container
+func NewNetworkMetric(input, output uint64) NetworkMetric {
+	return NetworkMetric{Input: input, Output: output, InputBytes: input, OutputBytes: output}
+}
+
+// NewBlockIOMetric returns the cumulative block IO counters of a container
+func NewBlockIOMetric(read, write uint64) BlockIOMetric {
+	return BlockIOMetric{Read: read, Write: write}
+}
+
+// HumanContainerMetric is the units=human response of /metrics/containers:
+// a ContainerMetric whose sizes are scaled for display, with their unit
+type HumanContainerMetric struct {
+	ContainerMetric
+	Memory  HumanMemoryMetric  `json:"Memory"`
+	Network HumanNetworkMetric `json:"Network"`
+	BlockIO HumanBlockIOMetric `json:"BlockIO"`
+}
+
+type HumanMemoryMetric struct {
+	Percentage float64 `json:"percentage"`
+	Used       float64 `json:"used"`
+	Total      float64 `json:"total"`
+	UsedUnit   string  `json:"usedUnit"`
+	TotalUnit  string  `json:"totalUnit"`
+}
+
+type HumanNetworkMetric struct {
+	Input       float64 `json:"input"`
+	Output      float64 `json:"output"`
+	InputUnit   string  `json:"inputUnit"`
+	OutputUnit  string  `json:"outputUnit"`
+	InputBytes  uint64  `json:"inputBytes"`
+	OutputBytes uint64  `json:"outputBytes"`
+	InputRate   float64 `json:"inputRate"`
+	OutputRate  float64 `json:"outputRate"`
+}
+
+type HumanBlockIOMetric struct {
+	Read      float64 `json:"read"`
+	Write     float64 `json:"write"`
+	ReadUnit  string  `json:"readUnit"`
+	WriteUnit string  `json:"writeUnit"`
+}
+
+// HumanizeUnits scales the sizes of each sample for display, with the units
+// the API returned before sizes were stored in bytes: memory in 1024
+// multiples, network and block IO in 1000 multiples. With rates the network
+// values are bytes per second.
+func HumanizeUnits(metrics []ContainerMetric, rates bool) []HumanContainerMetric {
+	result := make([]HumanContainerMetric, len(metrics))
+	for i, m := range metrics {
+		h := HumanContainerMetric{ContainerMetric: m}
+		h.Memory = HumanMemoryMetric{Percentage: m.Memory.Percentage}
+		h.Memory.Used, h.Memory.UsedUnit = humanizeBinary(float64(m.Memory.Used))
+		h.Memory.Total, h.Memory.TotalUnit = humanizeBinary(float64(m.Memory.Total))
+
+		h.Network = HumanNetworkMetric{
+			InputBytes:  m.Network.InputBytes,
+			OutputBytes: m.Network.OutputBytes,
+			InputRate:   m.Network.InputRate,
+			OutputRate:  m.Network.OutputRate,
+		}
+		if rates {
+			h.Network.Input, h.Network.InputUnit = humanizeDecimal(m.Network.InputRate)
+			h.Network.Output, h.Network.OutputUnit = humanizeDecimal(m.Network.OutputRate)
+			h.Network.InputUnit += "/s"
+			h.Network.OutputUnit += "/s"
+		} else {
+			h.Network.Input, h.Network.InputUnit = humanizeDecimal(float64(m.Network.Input))
+			h.Network.Output, h.Network.OutputUnit = humanizeDecimal(float64(m.Network.Output))
+		}
+
+		h.BlockIO.Read, h.BlockIO.ReadUnit = humanizeDecimal(float64(m.BlockIO.Read))
+		h.BlockIO.Write, h.BlockIO.WriteUnit = humanizeDecimal(float64(m.BlockIO.Write))
+		result[i] = h
+	}
+	return result
+}
+
+func humanizeBinary(bytes float64) (float64, string) {
+	return humanize(bytes, 1024, []string{"B", "KB", "MB", "GB", "TB"})
+}
+
+func humanizeDecimal(bytes float64) (float64, string) {
+	return humanize(bytes, 1000, []string{"B", "kB", "MB", "GB", "TB"})
+}
+
+func humanize(value, base float64, units []string) (float64, string) {
+	i := 0
+	for value >= base && i < len(units)-1 {
+		value /= base
+		i++
+	}
+	return round2(value), units[i]
+}
+
+// containerBytesVersion is the PRAGMA user_version of databases whose
+// container sizes are stored in bytes
+const containerBytesVersion = 1
+
+// migrateContainerUnits converts the sizes stored by older versions as a
+// scaled value and a unit ("2.26 MB", "KiB", "kB"...) to bytes and drops the
+// units. It runs once; the database is then marked with
+// containerBytesVersion.
+func (db *DB) migrateContainerUnits() error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("error reading schema version: %v", err)
+	}
+	if version >= containerBytesVersion {
+		return nil
+	}
+
+	type size struct {
+		path, unitPath, bytesPath string
+		base                      float64
+	}
+	sizes := []size{
+		{"$.Memory.used", "$.Memory.usedUnit", "", 1024},
+		{"$.Memory.total", "$.Memory.totalUnit", "", 1024},
+		{"$.Network.input", "$.Network.inputUnit", "$.Network.inputBytes", 1000},
+		{"$.Network.output", "$.Network.outputUnit", "$.Network.outputBytes", 1000},
+		{"$.BlockIO.read", "$.BlockIO.readUnit", "", 1000},
+		{"$.BlockIO.write", "$.BlockIO.writeUnit", "", 1000},
+	}
+
+	var sets, units, conditions []string
+	for _, s := range sizes {
+		expr := fmt.Sprintf("CAST(round(%s) AS INTEGER)", bytesExpr(s.path, s.unitPath, s.base))
+		if s.bytesPath != "" {
+			// The exact counters are preferred over the rounded scaled value,
+			// and filled in for the rows written before they existed
+			expr = fmt.Sprintf("coalesce(json_extract(metrics_json, '%s'), %s)", s.bytesPath, expr)
+			sets = append(sets, fmt.Sprintf("'%s', %s", s.bytesPath, expr))
+		}
+		sets = append(sets, fmt.Sprintf("'%s', %s", s.path, expr))
+		units = append(units, fmt.Sprintf("'%s'", s.unitPath))
+		conditions = append(conditions, fmt.Sprintf("json_type(metrics_json, '%s') IS NOT NULL", s.unitPath))
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE container_metrics
+		SET metrics_json = json_remove(json_set(metrics_json, ` + strings.Join(sets, ", ") + `), ` + strings.Join(units, ", ") + `)
+		WHERE ` + strings.Join(conditions, " OR "))
+	if err != nil {
+		return fmt.Errorf("error migrating container metric units: %v", err)
+	}
+	if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, containerBytesVersion)); err != nil {
+		return fmt.Errorf("error setting schema version: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err == nil && n > 0 {
+		log.Printf("Converted the sizes of %d container metric rows to bytes", n)
+	}
+	return nil
+}
+
+// bytesExpr converts a value/unit pair stored by older versions to bytes in
+// SQL. Explicit binary units (KiB, MiB...) always use 1024; otherwise base
+// decides.
+func bytesExpr(path, unitPath string, base float64) string {
+	value := fmt.Sprintf("json_extract(metrics_json, '%s')", path)
+	unit := fmt.Sprintf("json_extract(metrics_json, '%s')", unitPath)
+	return fmt.Sprintf(`%s * CASE
+		WHEN %[2]s LIKE '_iB' THEN CASE upper(substr(%[2]s, 1, 1)) WHEN 'K' THEN 1024.0 WHEN 'M' THEN 1048576.0 WHEN 'G' THEN 1073741824.0 WHEN 'T' THEN 1099511627776.0 ELSE 1 END
+		ELSE CASE upper(substr(%[2]s, 1, 1)) WHEN 'K' THEN %[3]g WHEN 'M' THEN %[3]g * %[3]g WHEN 'G' THEN %[3]g * %[3]g * %[3]g WHEN 'T' THEN %[3]g * %[3]g * %[3]g * %[3]g ELSE 1 END
+	END`, value, unit, base)
+}
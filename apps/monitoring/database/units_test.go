@@ -0,0 +1,194 @@
+package database
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMigrateContainerUnits(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.InitContainerMetricsTable(); err != nil {
+		t.Fatalf("InitContainerMetricsTable: %v", err)
+	}
+	// Rows written by versions storing scaled values with their unit
+	if _, err := db.Exec(`PRAGMA user_version = 0`); err != nil {
+		t.Fatal(err)
+	}
+	legacy := []string{
+		`{"Memory": {"percentage": 0.24, "used": 2.5, "total": 1, "usedUnit": "MiB", "totalUnit": "GiB"},
+		  "Network": {"input": 1.5, "output": 250, "inputUnit": "MB", "outputUnit": "kB"},
+		  "BlockIO": {"read": 3, "write": 0, "readUnit": "KB", "writeUnit": "B"}}`,
+		// Memory without an explicit binary unit, and the exact network
+		// counters already stored next to the scaled values
+		`{"Memory": {"used": 2, "total": 1.5, "usedUnit": "MB", "totalUnit": "GB"},
+		  "Network": {"input": 1.23, "output": 4.57, "inputUnit": "MB", "outputUnit": "kB", "inputBytes": 1234567, "outputBytes": 4567},
+		  "BlockIO": {"read": 1.2, "write": 2, "readUnit": "MiB", "writeUnit": "GB"}}`,
+		// Already in bytes
+		`{"Memory": {"used": 1024, "total": 2048},
+		  "Network": {"input": 10, "output": 20, "inputBytes": 10, "outputBytes": 20},
+		  "BlockIO": {"read": 30, "write": 40}}`,
+	}
+	for _, metrics := range legacy {
+		if _, err := db.Exec(`
+			INSERT INTO container_metrics (timestamp, container_id, container_name, metrics_json)
+			VALUES ('2024-01-01T00:00:00Z', 'web1', 'web', ?)`, metrics); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.migrateContainerUnits(); err != nil {
+		t.Fatalf("migrateContainerUnits: %v", err)
+	}
+
+	want := []struct {
+		memory  MemoryMetric
+		network NetworkMetric
+		blockIO BlockIOMetric
+	}{
+		{
+			memory:  MemoryMetric{Percentage: 0.24, Used: 2621440, Total: 1073741824},
+			network: NetworkMetric{Input: 1500000, Output: 250000, InputBytes: 1500000, OutputBytes: 250000},
+			blockIO: BlockIOMetric{Read: 3000},
+		},
+		{
+			memory:  MemoryMetric{Used: 2097152, Total: 1610612736},
+			network: NetworkMetric{Input: 1234567, Output: 4567, InputBytes: 1234567, OutputBytes: 4567},
+			blockIO: BlockIOMetric{Read: 1258291, Write: 2000000000},
+		},
+		{
+			memory:  MemoryMetric{Used: 1024, Total: 2048},
+			network: NetworkMetric{Input: 10, Output: 20, InputBytes: 10, OutputBytes: 20},
+			blockIO: BlockIOMetric{Read: 30, Write: 40},
+		},
+	}
+	rows := containerMetricRows(t, db)
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(want))
+	}
+	for i, w := range want {
+		var got ContainerMetric
+		if err := json.Unmarshal([]byte(rows[i]), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Memory != w.memory || got.Network != w.network || got.BlockIO != w.blockIO {
+			t.Errorf("row %d: got %+v %+v %+v, want %+v %+v %+v",
+				i, got.Memory, got.Network, got.BlockIO, w.memory, w.network, w.blockIO)
+		}
+		var units map[string]map[string]interface{}
+		if err := json.Unmarshal([]byte(rows[i]), &units); err != nil {
+			t.Fatal(err)
+		}
+		for _, unit := range []string{"usedUnit", "totalUnit"} {
+			if _, ok := units["Memory"][unit]; ok {
+				t.Errorf("row %d: %s was not dropped", i, unit)
+			}
+		}
+	}
+
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != containerBytesVersion {
+		t.Fatalf("got user_version %d, want %d", version, containerBytesVersion)
+	}
+
+	// A second run leaves the rows alone, even one that still has a unit
+	if _, err := db.Exec(`
+		INSERT INTO container_metrics (timestamp, container_id, container_name, metrics_json)
+		VALUES ('2024-01-01T00:00:10Z', 'web1', 'web', ?)`, legacy[0]); err != nil {
+		t.Fatal(err)
+	}
+	before := containerMetricRows(t, db)
+	if err := db.migrateContainerUnits(); err != nil {
+		t.Fatalf("migrateContainerUnits: %v", err)
+	}
+	after := containerMetricRows(t, db)
+	for i := range before {
+		if before[i] != after[i] {
+			t.Errorf("row %d changed from %s to %s", i, before[i], after[i])
+		}
+	}
+}
+
+// containerMetricRows returns the stored metrics_json of every container
+// sample in insertion order
+func containerMetricRows(t *testing.T, db *DB) []string {
+	t.Helper()
+
+	rows, err := db.Query(`SELECT metrics_json FROM container_metrics ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var result []string
+	for rows.Next() {
+		var metrics string
+		if err := rows.Scan(&metrics); err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, metrics)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestHumanizeUnits(t *testing.T) {
+	metrics := []ContainerMetric{{
+		ID:      "web1",
+		Memory:  MemoryMetric{Percentage: 0.24, Used: 2621440, Total: 1073741824},
+		Network: NetworkMetric{Input: 1500000, Output: 999, InputBytes: 1500000, OutputBytes: 999, InputRate: 2500, OutputRate: 12.5},
+		BlockIO: BlockIOMetric{Read: 3 * 1000 * 1000 * 1000 * 1000 * 1000, Write: 1234},
+	}}
+
+	tests := []struct {
+		name    string
+		rates   bool
+		network HumanNetworkMetric
+	}{
+		{
+			name:    "counters",
+			network: HumanNetworkMetric{Input: 1.5, InputUnit: "MB", Output: 999, OutputUnit: "B"},
+		},
+		{
+			name:    "rates",
+			rates:   true,
+			network: HumanNetworkMetric{Input: 2.5, InputUnit: "kB/s", Output: 12.5, OutputUnit: "B/s"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := HumanizeUnits(metrics, tt.rates)
+			if len(got) != 1 {
+				t.Fatalf("got %d metrics, want 1", len(got))
+			}
+			h := got[0]
+			if h.ID != "web1" {
+				t.Errorf("got ID %q, want the sample metadata kept", h.ID)
+			}
+
+			// Memory is scaled in 1024 multiples
+			wantMemory := HumanMemoryMetric{Percentage: 0.24, Used: 2.5, UsedUnit: "MB", Total: 1, TotalUnit: "GB"}
+			if h.Memory != wantMemory {
+				t.Errorf("got memory %+v, want %+v", h.Memory, wantMemory)
+			}
+
+			// The exact counters and rates are kept next to the scaled values
+			wantNetwork := tt.network
+			wantNetwork.InputBytes, wantNetwork.OutputBytes = 1500000, 999
+			wantNetwork.InputRate, wantNetwork.OutputRate = 2500, 12.5
+			if h.Network != wantNetwork {
+				t.Errorf("got network %+v, want %+v", h.Network, wantNetwork)
+			}
+
+			// Values beyond the largest unit stay in it
+			wantBlockIO := HumanBlockIOMetric{Read: 3000, ReadUnit: "TB", Write: 1.23, WriteUnit: "kB"}
+			if h.BlockIO != wantBlockIO {
+				t.Errorf("got block IO %+v, want %+v", h.BlockIO, wantBlockIO)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"strconv"
@@ -19,15 +22,20 @@ import (
 func main() {
 	godotenv.Load()
 
+	if len(os.Args) > 1 && os.Args[1] == "validate-config" {
+		os.Exit(validateConfig(os.Args[2:]))
+	}
+
+	configPath := flag.String("config", "", "path to a JSON or YAML configuration file")
+	flag.Parse()
+	config.SetConfigPath(*configPath)
+
 	// Get configuration
 	cfg := config.GetMetricsConfig()
-	token := cfg.Server.Token
-	METRICS_URL_CALLBACK := cfg.Server.UrlCallback
-	log.Printf("Environment variables:")
-	log.Printf("METRICS_CONFIG: %s", os.Getenv("METRICS_CONFIG"))
-
-	if token == "" || METRICS_URL_CALLBACK == "" {
-		log.Fatal("token and urlCallback are required in the configuration")
+	if path := config.ConfigPath(); path != "" {
+		log.Printf("Configuration loaded from %s", path)
+	} else {
+		log.Printf("Configuration loaded from METRICS_CONFIG")
 	}
 
 	db, err := database.InitDB()
@@ -35,12 +43,17 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if err := db.InitRuntimeConfigTable(); err != nil {
+		log.Fatal(err)
+	}
+	loadRuntimeSettings(db)
+	cfg = config.GetMetricsConfig()
+
 	// Iniciar el sistema de limpieza de métricas
-	cleanupCron, err := database.StartMetricsCleanup(db.DB, cfg.Server.RetentionDays, cfg.Server.CronJob)
+	cleanupCron, err := database.StartMetricsCleanup(db.DB, cfg.Server.RetentionDays, cfg.Server.CronJob, cfg.ProcessRetention())
 	if err != nil {
 		log.Fatalf("Error starting metrics cleanup system: %v", err)
 	}
-	defer cleanupCron.Stop()
 
 	app := fiber.New()
 
@@ -65,34 +78,109 @@ func main() {
 	app.Get("/metrics", func(c *fiber.Ctx) error {
 		limit := c.Query("limit", "50")
 
-		var metrics []monitoring.SystemMetrics
-		if limit == "all" {
-			dbMetrics, err := db.GetAllMetrics()
-			if err != nil {
-				return c.Status(500).JSON(fiber.Map{
-					"error": "Failed to fetch metrics",
-				})
-			}
-			for _, m := range dbMetrics {
-				metrics = append(metrics, monitoring.ConvertToSystemMetrics(m))
-			}
-		} else {
-			n, err := strconv.Atoi(limit)
-			if err != nil {
+		from, to, hasRange, err := parseTimeRange(c)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		bucketQuery, bucketed, err := parseBucketQuery(c, from, to)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		rawNetwork, err := parseNetworkMode(c)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		var dbMetrics []database.ServerMetric
+		switch {
+		case bucketed:
+			dbMetrics, err = db.GetBucketedMetrics(bucketQuery)
+		case hasRange:
+			dbMetrics, err = db.GetMetricsInRange(from, to)
+		case limit == "all":
+			dbMetrics, err = db.GetAllMetrics()
+		default:
+			n, parseErr := strconv.Atoi(limit)
+			if parseErr != nil {
 				n = 50
 			}
-			dbMetrics, err := db.GetLastNMetrics(n)
+			dbMetrics, err = db.GetLastNMetrics(n)
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to fetch metrics",
+			})
+		}
+
+		var metrics []monitoring.SystemMetrics
+		for _, m := range dbMetrics {
+			metrics = append(metrics, monitoring.ConvertToSystemMetrics(m, rawNetwork))
+		}
+
+		return c.JSON(metrics)
+	})
+
+	app.Get("/metrics/network", seriesHandler("interface", "Failed to fetch network metrics", seriesQueries[database.InterfaceMetric]{
+		lastN:    db.GetLastNInterfaceMetrics,
+		all:      db.GetAllInterfaceMetrics,
+		inRange:  db.GetInterfaceMetricsInRange,
+		bucketed: db.GetBucketedInterfaceMetrics,
+	}))
+
+	app.Get("/metrics/disks", seriesHandler("mountpoint", "Failed to fetch disk metrics", seriesQueries[database.DiskMetric]{
+		lastN:    db.GetLastNDiskMetrics,
+		all:      db.GetAllDiskMetrics,
+		inRange:  db.GetDiskMetricsInRange,
+		bucketed: db.GetBucketedDiskMetrics,
+	}))
+
+	app.Get("/metrics/diskio", seriesHandler("device", "Failed to fetch disk I/O metrics", seriesQueries[database.DiskIOMetric]{
+		lastN:    db.GetLastNDiskIOMetrics,
+		all:      db.GetAllDiskIOMetrics,
+		inRange:  db.GetDiskIOMetricsInRange,
+		bucketed: db.GetBucketedDiskIOMetrics,
+	}))
+
+	app.Get("/metrics/cpu", seriesHandler("core", "Failed to fetch CPU metrics", seriesQueries[database.CPUCoreMetric]{
+		lastN:    db.GetLastNCPUCoreMetrics,
+		all:      db.GetAllCPUCoreMetrics,
+		inRange:  db.GetCPUCoreMetricsInRange,
+		bucketed: db.GetBucketedCPUCoreMetrics,
+	}))
+
+	app.Get("/processes", func(c *fiber.Ctx) error {
+		var at time.Time
+		if atParam := c.Query("at"); atParam != "" {
+			parsed, err := parseTimeParam(atParam)
 			if err != nil {
-				return c.Status(500).JSON(fiber.Map{
-					"error": "Failed to fetch metrics",
+				return c.Status(400).JSON(fiber.Map{
+					"error": fmt.Sprintf("invalid at %q: %v", atParam, err),
 				})
 			}
-			for _, m := range dbMetrics {
-				metrics = append(metrics, monitoring.ConvertToSystemMetrics(m))
-			}
+			at = parsed
 		}
 
-		return c.JSON(metrics)
+		snapshot, err := db.GetProcessSnapshot(at)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to fetch process snapshot",
+			})
+		}
+		if snapshot == nil {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "No process snapshot found",
+			})
+		}
+
+		return c.JSON(snapshot)
 	})
 
 	containerMonitor, err := containers.NewContainerMonitor(db)
@@ -112,10 +200,46 @@ func main() {
 			return c.JSON([]database.ContainerMetric{})
 		}
 
+		from, to, hasRange, err := parseTimeRange(c)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		bucketQuery, bucketed, err := parseBucketQuery(c, from, to)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		rawNetwork, err := parseNetworkMode(c)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		humanUnits, err := parseUnits(c)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if humanUnits && c.Query("aggregate") == "service" {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "units=human is not supported with aggregate=service",
+			})
+		}
+
 		var metrics []database.ContainerMetric
-		var err error
 
-		if limit == "all" {
+		if bucketed {
+			metrics, err = db.GetBucketedContainerMetrics(appName, bucketQuery)
+		} else if hasRange {
+			metrics, err = db.GetContainerMetricsInRange(appName, from, to)
+		} else if limit == "all" {
 			metrics, err = db.GetAllMetricsContainer(appName)
 		} else {
 			limitNum, parseErr := strconv.Atoi(limit)
@@ -131,34 +255,176 @@ func main() {
 			})
 		}
 
+		if !rawNetwork {
+			database.UseNetworkRates(metrics)
+		}
+
+		if c.Query("aggregate") == "service" {
+			return c.JSON(database.AggregateByService(metrics))
+		}
+
+		if humanUnits {
+			return c.JSON(database.HumanizeUnits(metrics, !rawNetwork))
+		}
+
 		return c.JSON(metrics)
 	})
 
-	go func() {
-		refreshRate := cfg.Server.RefreshRate
-		duration := time.Duration(refreshRate) * time.Second
+	app.Get("/metrics/containers/restarts", func(c *fiber.Ctx) error {
+		appName := c.Query("appName", "")
+		if appName == "" {
+			return c.JSON([]database.ContainerRestarts{})
+		}
+
+		from, to, hasRange, err := parseTimeRange(c)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if !hasRange {
+			from, to = time.Now().Add(-time.Hour), time.Now()
+		}
+
+		restarts, err := db.GetContainerRestarts(appName, from, to)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Error getting container restarts: " + err.Error(),
+			})
+		}
+
+		return c.JSON(restarts)
+	})
+
+	app.Get("/events", func(c *fiber.Ctx) error {
+		appName := c.Query("appName", "")
+		if appName == "" {
+			return c.JSON([]database.ContainerEvent{})
+		}
+
+		from, to, hasRange, err := parseTimeRange(c)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if !hasRange {
+			from, to = time.Unix(0, 0), time.Now()
+		}
+
+		events, err := db.GetContainerEvents(appName, from, to)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Error getting container events: " + err.Error(),
+			})
+		}
+
+		return c.JSON(events)
+	})
 
-		log.Printf("Refreshing server metrics every %v", duration)
-		ticker := time.NewTicker(duration)
-		defer ticker.Stop()
+	diskUsageMonitor := containers.NewDiskUsageMonitor(db)
+	diskUsageMonitor.Start()
+	defer diskUsageMonitor.Stop()
 
-		for range ticker.C {
-			metrics := monitoring.GetServerMetrics()
-			if err := db.SaveMetric(metrics); err != nil {
-				log.Printf("Error saving metrics: %v", err)
+	app.Get("/docker/disk", func(c *fiber.Ctx) error {
+		var at time.Time
+		if atParam := c.Query("at"); atParam != "" {
+			parsed, err := parseTimeParam(atParam)
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"error": fmt.Sprintf("invalid at %q: %v", atParam, err),
+				})
 			}
+			at = parsed
+		}
+
+		snapshot, err := db.GetDockerDiskSnapshot(at, c.Query("appName", ""))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "Failed to fetch Docker disk usage",
+			})
+		}
+		if snapshot == nil {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "No Docker disk usage collected yet",
+			})
+		}
+
+		return c.JSON(snapshot)
+	})
+
+	app.Get("/metrics/docker/disk", seriesHandler("type", "Failed to fetch Docker disk usage", seriesQueries[database.DockerDiskUsage]{
+		lastN:    db.GetLastNDockerDiskUsage,
+		all:      db.GetAllDockerDiskUsage,
+		inRange:  db.GetDockerDiskUsageInRange,
+		bucketed: db.GetBucketedDockerDiskUsage,
+	}))
 
-			if err := monitoring.CheckThresholds(metrics); err != nil {
-				log.Printf("Error checking thresholds: %v", err)
+	serverMonitor := monitoring.NewServerMonitor(db)
+	serverMonitor.Start()
+	defer serverMonitor.Stop()
+
+	reloader := &configReloader{
+		db:               db,
+		serverMonitor:    serverMonitor,
+		containerMonitor: containerMonitor,
+		diskUsageMonitor: diskUsageMonitor,
+		cleanupCron:      cleanupCron,
+	}
+	defer reloader.stopCleanup()
+	reloader.watch()
+
+	app.Get("/config", func(c *fiber.Ctx) error {
+		return c.JSON(config.EffectiveSettings(config.GetMetricsConfig()))
+	})
+
+	app.Patch("/config", func(c *fiber.Ctx) error {
+		updated, err := reloader.updateRuntimeSettings(c.Body())
+		if err != nil {
+			var validationErrs config.ValidationErrors
+			var patchErr invalidPatchError
+			switch {
+			case errors.As(err, &validationErrs):
+				details := make([]string, len(validationErrs))
+				for i, fieldErr := range validationErrs {
+					details[i] = fieldErr.Error()
+				}
+				return c.Status(400).JSON(fiber.Map{
+					"error":   "Invalid configuration",
+					"details": details,
+				})
+			case errors.As(err, &patchErr):
+				return c.Status(400).JSON(fiber.Map{
+					"error": patchErr.Error(),
+				})
+			default:
+				return c.Status(500).JSON(fiber.Map{
+					"error": "Error updating configuration: " + err.Error(),
+				})
 			}
 		}
-	}()
+
+		return c.JSON(config.EffectiveSettings(updated))
+	})
 
 	port := cfg.Server.Port
-	if port == 0 {
-		port = 3001
-	}
 
 	log.Printf("Server starting on port %d", port)
 	log.Fatal(app.Listen(":" + strconv.Itoa(port)))
 }
+
+// validateConfig implements `monitoring validate-config [--config path]`
+func validateConfig(args []string) int {
+	flags := flag.NewFlagSet("validate-config", flag.ExitOnError)
+	configPath := flags.String("config", "", "path to a JSON or YAML configuration file")
+	flags.Parse(args)
+	config.SetConfigPath(*configPath)
+
+	if _, err := config.LoadMetricsConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Println("configuration is valid")
+	return 0
+}
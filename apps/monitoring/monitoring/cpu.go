@@ -0,0 +1,106 @@
+package monitoring
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/load"
+
+	"github.com/mauriciogm/dokploy/apps/monitoring/database"
+)
+
+// cpuUsage is the share of CPU time spent in each state between two
+// samples, in percent
+type cpuUsage struct {
+	usage, user, system, nice, iowait, steal, irq, softirq float64
+}
+
+// cpuUsageBetween mirrors cpu.Percent: guest time is already part of user
+// time on Linux, and iowait counts as idle for the overall usage
+func cpuUsageBetween(previous, current cpu.TimesStat) cpuUsage {
+	total := func(t cpu.TimesStat) float64 {
+		return t.User + t.System + t.Nice + t.Idle + t.Iowait + t.Irq + t.Softirq + t.Steal
+	}
+
+	elapsed := total(current) - total(previous)
+	if elapsed <= 0 {
+		return cpuUsage{}
+	}
+	share := func(previous, current float64) float64 {
+		delta := current - previous
+		if delta < 0 {
+			return 0
+		}
+		return delta / elapsed * 100
+	}
+
+	idle := share(previous.Idle+previous.Iowait, current.Idle+current.Iowait)
+	return cpuUsage{
+		usage:   100 - idle,
+		user:    share(previous.User, current.User),
+		system:  share(previous.System, current.System),
+		nice:    share(previous.Nice, current.Nice),
+		iowait:  share(previous.Iowait, current.Iowait),
+		steal:   share(previous.Steal, current.Steal),
+		irq:     share(previous.Irq, current.Irq),
+		softirq: share(previous.Softirq, current.Softirq),
+	}
+}
+
+// sampleCPU measures the CPU time of the whole host and of every core over
+// interval. The caller sets the timestamp of the core samples.
+func sampleCPU(ctx context.Context, interval time.Duration) (cpuUsage, []database.CPUCoreMetric) {
+	totalBefore, _ := cpu.TimesWithContext(ctx, false)
+	coresBefore, _ := cpu.TimesWithContext(ctx, true)
+	time.Sleep(interval)
+	totalAfter, _ := cpu.TimesWithContext(ctx, false)
+	coresAfter, _ := cpu.TimesWithContext(ctx, true)
+
+	var total cpuUsage
+	if len(totalBefore) > 0 && len(totalAfter) > 0 {
+		total = cpuUsageBetween(totalBefore[0], totalAfter[0])
+	}
+
+	previous := make(map[string]cpu.TimesStat, len(coresBefore))
+	for _, t := range coresBefore {
+		previous[t.CPU] = t
+	}
+
+	cores := make([]database.CPUCoreMetric, 0, len(coresAfter))
+	for _, t := range coresAfter {
+		before, ok := previous[t.CPU]
+		if !ok {
+			continue
+		}
+		usage := cpuUsageBetween(before, t)
+		cores = append(cores, database.CPUCoreMetric{
+			Core:   t.CPU,
+			Usage:  usage.usage,
+			User:   usage.user,
+			System: usage.system,
+			Iowait: usage.iowait,
+			Steal:  usage.steal,
+			Irq:    usage.irq + usage.softirq,
+		})
+	}
+	return total, cores
+}
+
+// setLoadAverage fills the load averages, also divided by the number of
+// logical cores so 1.0 means every core is busy
+func setLoadAverage(ctx context.Context, metric *database.ServerMetric) {
+	avg, err := load.AvgWithContext(ctx)
+	if err != nil {
+		return
+	}
+	cores := float64(runtime.NumCPU())
+
+	metric.Load1 = avg.Load1
+	metric.Load5 = avg.Load5
+	metric.Load15 = avg.Load15
+	metric.Load1PerCore = avg.Load1 / cores
+	metric.Load5PerCore = avg.Load5 / cores
+	metric.Load15PerCore = avg.Load15 / cores
+}
@@ -0,0 +1,71 @@
+package monitoring
+
+import (
+	"math"
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+)
+
+func TestCPUUsageBetween(t *testing.T) {
+	previous := cpu.TimesStat{User: 100, System: 50, Nice: 5, Idle: 800, Iowait: 20, Irq: 5, Softirq: 10, Steal: 10}
+
+	tests := []struct {
+		name    string
+		current cpu.TimesStat
+		want    cpuUsage
+	}{
+		{
+			// 100s elapsed, iowait counting as idle
+			name:    "busy",
+			current: cpu.TimesStat{User: 130, System: 60, Nice: 5, Idle: 845, Iowait: 30, Irq: 5, Softirq: 12, Steal: 13},
+			want:    cpuUsage{usage: 45, user: 30, system: 10, iowait: 10, softirq: 2, steal: 3},
+		},
+		{
+			// Guest time is part of user time and is not counted twice
+			name:    "guest",
+			current: cpu.TimesStat{User: 150, System: 50, Nice: 5, Idle: 850, Iowait: 20, Irq: 5, Softirq: 10, Steal: 10, Guest: 40},
+			want:    cpuUsage{usage: 50, user: 50},
+		},
+		{
+			name:    "idle",
+			current: cpu.TimesStat{User: 100, System: 50, Nice: 5, Idle: 900, Iowait: 20, Irq: 5, Softirq: 10, Steal: 10},
+			want:    cpuUsage{},
+		},
+		{
+			// The same counters twice must not divide by zero
+			name:    "no time elapsed",
+			current: previous,
+			want:    cpuUsage{},
+		},
+		{
+			// A counter going backwards (hotplugged core) is clamped to 0
+			name:    "counter going backwards",
+			current: cpu.TimesStat{User: 90, System: 70, Nice: 5, Idle: 890, Iowait: 20, Irq: 5, Softirq: 10, Steal: 10},
+			want:    cpuUsage{usage: 10, system: 20},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cpuUsageBetween(previous, tt.current)
+			for _, field := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"usage", got.usage, tt.want.usage},
+				{"user", got.user, tt.want.user},
+				{"system", got.system, tt.want.system},
+				{"nice", got.nice, tt.want.nice},
+				{"iowait", got.iowait, tt.want.iowait},
+				{"steal", got.steal, tt.want.steal},
+				{"irq", got.irq, tt.want.irq},
+				{"softirq", got.softirq, tt.want.softirq},
+			} {
+				if math.Abs(field.got-field.want) > 1e-9 {
+					t.Errorf("got %s %v, want %v", field.name, field.got, field.want)
+				}
+			}
+		})
+	}
+}
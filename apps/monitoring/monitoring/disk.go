@@ -0,0 +1,90 @@
+package monitoring
+
+import (
+	"context"
+	"log"
+
+	"github.com/shirou/gopsutil/v3/disk"
+
+	"github.com/mauriciogm/dokploy/apps/monitoring/config"
+	"github.com/mauriciogm/dokploy/apps/monitoring/database"
+)
+
+// getDiskMetrics returns the usage of server.disk.mountpoints, or of every
+// mounted filesystem whose type is not excluded when the list is empty.
+// Mountpoints are host paths, read under server.hostRoot.
+func getDiskMetrics(ctx context.Context, timestamp string) []database.DiskMetric {
+	cfg := config.GetMetricsConfig()
+
+	partitions, err := disk.PartitionsWithContext(ctx, false)
+	if err != nil {
+		log.Printf("Error listing mounted filesystems: %v", err)
+	}
+	devices := make(map[string]string, len(partitions))
+	for _, partition := range partitions {
+		devices[partition.Mountpoint] = partition.Device
+	}
+
+	mountpoints := cfg.Server.Disk.Mountpoints
+	if len(mountpoints) == 0 {
+		mountpoints = discoverMountpoints(partitions, cfg.Server.Disk.ExcludeFsTypes)
+	}
+
+	metrics := make([]database.DiskMetric, 0, len(mountpoints))
+	for _, mountpoint := range mountpoints {
+		usage, err := disk.UsageWithContext(ctx, cfg.HostPath(mountpoint))
+		if err != nil {
+			log.Printf("Error reading disk usage of %s: %v", mountpoint, err)
+			continue
+		}
+		metrics = append(metrics, database.DiskMetric{
+			Timestamp:         timestamp,
+			Mountpoint:        mountpoint,
+			Device:            devices[mountpoint],
+			Fstype:            usage.Fstype,
+			Total:             usage.Total,
+			Used:              usage.Used,
+			Free:              usage.Free,
+			UsedPercent:       usage.UsedPercent,
+			InodesTotal:       usage.InodesTotal,
+			InodesUsed:        usage.InodesUsed,
+			InodesFree:        usage.InodesFree,
+			InodesUsedPercent: usage.InodesUsedPercent,
+		})
+	}
+	return metrics
+}
+
+// discoverMountpoints lists the real filesystems. A device mounted more than
+// once (bind mounts) is only reported at its shortest mountpoint.
+func discoverMountpoints(partitions []disk.PartitionStat, excludeFsTypes []string) []string {
+	if len(partitions) == 0 {
+		return []string{"/"}
+	}
+
+	excluded := make(map[string]bool, len(excludeFsTypes))
+	for _, fstype := range excludeFsTypes {
+		excluded[fstype] = true
+	}
+
+	byDevice := make(map[string]string)
+	var devices []string
+	for _, partition := range partitions {
+		if excluded[partition.Fstype] {
+			continue
+		}
+		current, ok := byDevice[partition.Device]
+		if !ok {
+			devices = append(devices, partition.Device)
+		}
+		if !ok || len(partition.Mountpoint) < len(current) {
+			byDevice[partition.Device] = partition.Mountpoint
+		}
+	}
+
+	mountpoints := make([]string, 0, len(devices))
+	for _, device := range devices {
+		mountpoints = append(mountpoints, byDevice[device])
+	}
+	return mountpoints
+}
@@ -0,0 +1,68 @@
+package monitoring
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+func TestDiscoverMountpoints(t *testing.T) {
+	partitions := []disk.PartitionStat{
+		{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"},
+		{Device: "/dev/sda2", Mountpoint: "/boot/efi", Fstype: "vfat"},
+		// Bind mounts of the root filesystem
+		{Device: "/dev/sda1", Mountpoint: "/var/lib/docker/volumes/data", Fstype: "ext4"},
+		{Device: "/dev/sda1", Mountpoint: "/etc/hostname", Fstype: "ext4"},
+		{Device: "overlay", Mountpoint: "/var/lib/docker/overlay2/abc/merged", Fstype: "overlay"},
+		{Device: "/dev/loop0", Mountpoint: "/snap/core/1", Fstype: "squashfs"},
+		{Device: "/dev/sdb1", Mountpoint: "/mnt/data", Fstype: "xfs"},
+	}
+
+	tests := []struct {
+		name       string
+		partitions []disk.PartitionStat
+		exclude    []string
+		want       []string
+	}{
+		{
+			name:       "every filesystem",
+			partitions: partitions,
+			want:       []string{"/", "/boot/efi", "/var/lib/docker/overlay2/abc/merged", "/snap/core/1", "/mnt/data"},
+		},
+		{
+			name:       "excluded types",
+			partitions: partitions,
+			exclude:    []string{"overlay", "squashfs", "vfat"},
+			want:       []string{"/", "/mnt/data"},
+		},
+		{
+			// The shortest mountpoint is kept even when it is listed last
+			name: "bind mount listed first",
+			partitions: []disk.PartitionStat{
+				{Device: "/dev/sda1", Mountpoint: "/etc/hosts", Fstype: "ext4"},
+				{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"},
+			},
+			want: []string{"/"},
+		},
+		{
+			name:       "everything excluded",
+			partitions: partitions[:1],
+			exclude:    []string{"ext4"},
+			want:       []string{},
+		},
+		{
+			// The partitions could not be listed
+			name: "no partitions",
+			want: []string{"/"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := discoverMountpoints(tt.partitions, tt.exclude); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
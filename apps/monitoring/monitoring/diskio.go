@@ -0,0 +1,62 @@
+package monitoring
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/disk"
+
+	"github.com/mauriciogm/dokploy/apps/monitoring/config"
+	"github.com/mauriciogm/dokploy/apps/monitoring/database"
+)
+
+// getDiskIOMetrics returns the counters of the whole block devices. Partitions
+// are left out since their I/O is already counted on the disk, as well as
+// loop and ram devices.
+func getDiskIOMetrics(ctx context.Context, timestamp string) []database.DiskIOMetric {
+	counters, err := disk.IOCountersWithContext(ctx)
+	if err != nil {
+		log.Printf("Error reading disk I/O counters: %v", err)
+		return nil
+	}
+
+	devices := blockDevices(config.GetMetricsConfig().HostPath("/sys/block"))
+
+	var metrics []database.DiskIOMetric
+	for name, c := range counters {
+		if devices != nil && !devices[name] {
+			continue
+		}
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+			continue
+		}
+		metrics = append(metrics, database.DiskIOMetric{
+			Timestamp:  timestamp,
+			Device:     name,
+			ReadBytes:  c.ReadBytes,
+			WriteBytes: c.WriteBytes,
+			ReadCount:  c.ReadCount,
+			WriteCount: c.WriteCount,
+			ReadTime:   c.ReadTime,
+			WriteTime:  c.WriteTime,
+			IoTime:     c.IoTime,
+		})
+	}
+	return metrics
+}
+
+// blockDevices lists the whole disks, or returns nil when /sys is not
+// available so every device is kept
+func blockDevices(sysBlock string) map[string]bool {
+	entries, err := os.ReadDir(sysBlock)
+	if err != nil {
+		return nil
+	}
+	devices := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		devices[entry.Name()] = true
+	}
+	return devices
+}
@@ -0,0 +1,23 @@
+package monitoring
+
+import (
+	"context"
+
+	"github.com/shirou/gopsutil/v3/common"
+
+	"github.com/mauriciogm/dokploy/apps/monitoring/config"
+)
+
+// hostContext makes gopsutil read /proc, /sys, /etc and the other host
+// filesystems under server.hostRoot instead of the ones of the agent container
+func hostContext(cfg *config.Config) context.Context {
+	return context.WithValue(context.Background(), common.EnvKey, common.EnvMap{
+		common.HostRootEnvKey: cfg.Server.HostRoot,
+		common.HostProcEnvKey: cfg.HostPath(cfg.Server.ProcRoot),
+		common.HostSysEnvKey:  cfg.HostPath("/sys"),
+		common.HostEtcEnvKey:  cfg.HostPath("/etc"),
+		common.HostVarEnvKey:  cfg.HostPath("/var"),
+		common.HostRunEnvKey:  cfg.HostPath("/run"),
+		common.HostDevEnvKey:  cfg.HostPath("/dev"),
+	})
+}
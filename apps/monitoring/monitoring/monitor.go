@@ -7,7 +7,7 @@ import (
 	"io"
 	"net/http"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"time"
@@ -16,7 +16,6 @@ import (
 	"github.com/shirou/gopsutil/v3/disk"
 	"github.com/shirou/gopsutil/v3/host"
 	"github.com/shirou/gopsutil/v3/mem"
-	"github.com/shirou/gopsutil/v3/net"
 
 	"github.com/mauriciogm/dokploy/apps/monitoring/config"
 	"github.com/mauriciogm/dokploy/apps/monitoring/database"
@@ -41,6 +40,35 @@ type SystemMetrics struct {
 	NetworkIn        string  `json:"networkIn"`
 	NetworkOut       string  `json:"networkOut"`
 	Timestamp        string  `json:"timestamp"`
+
+	CPUUser       string `json:"cpuUser"`
+	CPUSystem     string `json:"cpuSystem"`
+	CPUNice       string `json:"cpuNice"`
+	CPUIowait     string `json:"cpuIowait"`
+	CPUSteal      string `json:"cpuSteal"`
+	CPUIrq        string `json:"cpuIrq"`
+	CPUSoftirq    string `json:"cpuSoftirq"`
+	Load1         string `json:"load1"`
+	Load5         string `json:"load5"`
+	Load15        string `json:"load15"`
+	Load1PerCore  string `json:"load1PerCore"`
+	Load5PerCore  string `json:"load5PerCore"`
+	Load15PerCore string `json:"load15PerCore"`
+
+	// Memory and swap sizes are in bytes, swap rates in bytes per second
+	MemAvailable    uint64 `json:"memAvailable"`
+	MemBuffers      uint64 `json:"memBuffers"`
+	MemCached       uint64 `json:"memCached"`
+	MemShared       uint64 `json:"memShared"`
+	MemDirty        uint64 `json:"memDirty"`
+	MemWriteback    uint64 `json:"memWriteback"`
+	SwapTotal       uint64 `json:"swapTotal"`
+	SwapUsed        uint64 `json:"swapUsed"`
+	SwapUsedPercent string `json:"swapUsedPercent"`
+	SwapInRate      string `json:"swapInRate"`
+	SwapOutRate     string `json:"swapOutRate"`
+
+	Pressure database.PressureMetric `json:"pressure"`
 }
 
 type AlertPayload struct {
@@ -51,10 +79,17 @@ type AlertPayload struct {
 	Message    string  `json:"Message"`
 	Timestamp  string  `json:"Timestamp"`
 	Token      string  `json:"Token"`
+	Mountpoint string  `json:"Mountpoint,omitempty"`
+
+	// Top processes when the alert fired, by CPU for CPU alerts and by
+	// memory for memory alerts
+	Processes []database.ProcessMetric `json:"Processes,omitempty"`
 }
 
-func getRealOS() string {
-	if content, err := os.ReadFile("/etc/os-release"); err == nil {
+// getRealOS reads the distribution of the host, not the one of the agent
+// container
+func getRealOS(cfg *config.Config) string {
+	if content, err := os.ReadFile(cfg.HostPath("/etc/os-release")); err == nil {
 		lines := strings.Split(string(content), "\n")
 		var id, name, version string
 		for _, line := range lines {
@@ -79,7 +114,7 @@ func getRealOS() string {
 		}
 	}
 
-	if content, err := os.ReadFile("/etc/system-release"); err == nil {
+	if content, err := os.ReadFile(cfg.HostPath("/etc/system-release")); err == nil {
 		text := strings.ToLower(string(content))
 		switch {
 		case strings.Contains(text, "red hat"):
@@ -91,9 +126,15 @@ func getRealOS() string {
 		}
 	}
 
-	cmd := exec.Command("uname", "-a")
-	if output, err := cmd.Output(); err == nil {
-		osInfo := strings.ToLower(string(output))
+	// The same fields as `uname -srv`, read from the host proc filesystem
+	var uname []string
+	for _, name := range []string{"ostype", "osrelease", "version"} {
+		if content, err := os.ReadFile(filepath.Join(cfg.HostPath(cfg.Server.ProcRoot), "sys", "kernel", name)); err == nil {
+			uname = append(uname, strings.TrimSpace(string(content)))
+		}
+	}
+	if len(uname) > 0 {
+		osInfo := strings.ToLower(strings.Join(uname, " "))
 		switch {
 		case strings.Contains(osInfo, "debian"):
 			return "debian"
@@ -116,13 +157,15 @@ func getRealOS() string {
 }
 
 func GetServerMetrics() database.ServerMetric {
-	v, _ := mem.VirtualMemory()
-	c, _ := cpu.Percent(time.Second, false)
-	cpuInfo, _ := cpu.Info()
-	diskInfo, _ := disk.Usage("/")
-	netInfo, _ := net.IOCounters(false)
-	hostInfo, _ := host.Info()
-	distro := getRealOS()
+	cfg := config.GetMetricsConfig()
+	ctx := hostContext(cfg)
+
+	v, _ := mem.VirtualMemoryWithContext(ctx)
+	cpuTotal, cores := sampleCPU(ctx, time.Second)
+	cpuInfo, _ := cpu.InfoWithContext(ctx)
+	diskInfo, _ := disk.UsageWithContext(ctx, cfg.HostPath("/"))
+	hostInfo, _ := host.InfoWithContext(ctx)
+	distro := getRealOS(cfg)
 
 	cpuModel := ""
 	if len(cpuInfo) > 0 {
@@ -134,19 +177,28 @@ func GetServerMetrics() database.ServerMetric {
 	memUsedGB := memTotalGB - memAvailableGB
 	memUsedPercent := (memUsedGB / memTotalGB) * 100
 
-	var networkIn, networkOut float64
-	if len(netInfo) > 0 {
-		networkIn = float64(netInfo[0].BytesRecv) / 1024 / 1024
-		networkOut = float64(netInfo[0].BytesSent) / 1024 / 1024
+	timestamp := time.Now().UTC().Format(time.RFC3339Nano)
+	for i := range cores {
+		cores[i].Timestamp = timestamp
+	}
+
+	// The host totals only count the selected interfaces so loopback and
+	// container traffic are not mixed with the uplink
+	interfaces := getInterfaceMetrics(ctx, timestamp)
+	var networkIn, networkOut uint64
+	for _, iface := range interfaces {
+		networkIn += iface.BytesRecv
+		networkOut += iface.BytesSent
 	}
-	return database.ServerMetric{
-		Timestamp:        time.Now().UTC().Format(time.RFC3339Nano),
-		CPU:              c[0],
+
+	metric := database.ServerMetric{
+		Timestamp:        timestamp,
+		CPU:              cpuTotal.usage,
 		CPUModel:         cpuModel,
 		CPUCores:         int32(runtime.NumCPU()),
 		CPUPhysicalCores: int32(len(cpuInfo)),
 		CPUSpeed:         float64(cpuInfo[0].Mhz),
-		OS:               getRealOS(),
+		OS:               distro,
 		Distro:           distro,
 		Kernel:           hostInfo.KernelVersion,
 		Arch:             hostInfo.KernelArch,
@@ -156,12 +208,51 @@ func GetServerMetrics() database.ServerMetric {
 		Uptime:           hostInfo.Uptime,
 		DiskUsed:         float64(diskInfo.UsedPercent),
 		TotalDisk:        float64(diskInfo.Total) / 1024 / 1024 / 1024,
-		NetworkIn:        networkIn,
-		NetworkOut:       networkOut,
+		NetworkInBytes:   networkIn,
+		NetworkOutBytes:  networkOut,
+		Interfaces:       interfaces,
+		Disks:            getDiskMetrics(ctx, timestamp),
+		DiskIO:           getDiskIOMetrics(ctx, timestamp),
+		CPUUser:          cpuTotal.user,
+		CPUSystem:        cpuTotal.system,
+		CPUNice:          cpuTotal.nice,
+		CPUIowait:        cpuTotal.iowait,
+		CPUSteal:         cpuTotal.steal,
+		CPUIrq:           cpuTotal.irq,
+		CPUSoftirq:       cpuTotal.softirq,
+		Cores:            cores,
+		MemAvailable:     v.Available,
+		MemBuffers:       v.Buffers,
+		MemCached:        v.Cached,
+		MemShared:        v.Shared,
+		MemDirty:         v.Dirty,
+		MemWriteback:     v.WriteBack,
+		Pressure:         getPressure(cfg.HostPath(cfg.Server.ProcRoot)),
+	}
+	setLoadAverage(ctx, &metric)
+
+	if swap, err := mem.SwapMemoryWithContext(ctx); err == nil {
+		metric.SwapTotal = swap.Total
+		metric.SwapUsed = swap.Used
+		metric.SwapUsedPercent = swap.UsedPercent
+		metric.SwapIn = swap.Sin
+		metric.SwapOut = swap.Sout
 	}
+
+	return metric
 }
 
-func ConvertToSystemMetrics(metric database.ServerMetric) SystemMetrics {
+// ConvertToSystemMetrics formats a stored sample for the API. Network values
+// are rates in bytes per second, or the cumulative counters in bytes when
+// rawNetwork is set.
+func ConvertToSystemMetrics(metric database.ServerMetric, rawNetwork bool) SystemMetrics {
+	networkIn := fmt.Sprintf("%.2f", metric.NetworkInRate)
+	networkOut := fmt.Sprintf("%.2f", metric.NetworkOutRate)
+	if rawNetwork {
+		networkIn = fmt.Sprintf("%d", metric.NetworkInBytes)
+		networkOut = fmt.Sprintf("%d", metric.NetworkOutBytes)
+	}
+
 	return SystemMetrics{
 		CPU:              fmt.Sprintf("%.2f", metric.CPU),
 		CPUModel:         metric.CPUModel,
@@ -178,9 +269,34 @@ func ConvertToSystemMetrics(metric database.ServerMetric) SystemMetrics {
 		Uptime:           metric.Uptime,
 		DiskUsed:         fmt.Sprintf("%.2f", metric.DiskUsed),
 		TotalDisk:        fmt.Sprintf("%.2f", metric.TotalDisk),
-		NetworkIn:        fmt.Sprintf("%.2f", metric.NetworkIn),
-		NetworkOut:       fmt.Sprintf("%.2f", metric.NetworkOut),
+		NetworkIn:        networkIn,
+		NetworkOut:       networkOut,
 		Timestamp:        metric.Timestamp,
+		CPUUser:          fmt.Sprintf("%.2f", metric.CPUUser),
+		CPUSystem:        fmt.Sprintf("%.2f", metric.CPUSystem),
+		CPUNice:          fmt.Sprintf("%.2f", metric.CPUNice),
+		CPUIowait:        fmt.Sprintf("%.2f", metric.CPUIowait),
+		CPUSteal:         fmt.Sprintf("%.2f", metric.CPUSteal),
+		CPUIrq:           fmt.Sprintf("%.2f", metric.CPUIrq),
+		CPUSoftirq:       fmt.Sprintf("%.2f", metric.CPUSoftirq),
+		Load1:            fmt.Sprintf("%.2f", metric.Load1),
+		Load5:            fmt.Sprintf("%.2f", metric.Load5),
+		Load15:           fmt.Sprintf("%.2f", metric.Load15),
+		Load1PerCore:     fmt.Sprintf("%.2f", metric.Load1PerCore),
+		Load5PerCore:     fmt.Sprintf("%.2f", metric.Load5PerCore),
+		Load15PerCore:    fmt.Sprintf("%.2f", metric.Load15PerCore),
+		MemAvailable:     metric.MemAvailable,
+		MemBuffers:       metric.MemBuffers,
+		MemCached:        metric.MemCached,
+		MemShared:        metric.MemShared,
+		MemDirty:         metric.MemDirty,
+		MemWriteback:     metric.MemWriteback,
+		SwapTotal:        metric.SwapTotal,
+		SwapUsed:         metric.SwapUsed,
+		SwapUsedPercent:  fmt.Sprintf("%.2f", metric.SwapUsedPercent),
+		SwapInRate:       fmt.Sprintf("%.2f", metric.SwapInRate),
+		SwapOutRate:      fmt.Sprintf("%.2f", metric.SwapOutRate),
+		Pressure:         metric.Pressure,
 	}
 }
 
@@ -188,6 +304,22 @@ func CheckThresholds(metrics database.ServerMetric) error {
 	cfg := config.GetMetricsConfig()
 	cpuThreshold := float64(cfg.Server.Thresholds.CPU)
 	memThreshold := float64(cfg.Server.Thresholds.Memory)
+	diskThreshold := float64(cfg.Server.Thresholds.Disk)
+	inodesThreshold := float64(cfg.Server.Thresholds.Inodes)
+	swapThreshold := float64(cfg.Server.Thresholds.Swap)
+	pressureThresholds := []struct {
+		resource  string
+		threshold float64
+		value     float64
+	}{
+		{"CPU", float64(cfg.Server.Thresholds.CPUPressure), metrics.Pressure.CPU.Some.Avg60},
+		{"Memory", float64(cfg.Server.Thresholds.MemoryPressure), metrics.Pressure.Memory.Some.Avg60},
+		{"IO", float64(cfg.Server.Thresholds.IOPressure), metrics.Pressure.IO.Some.Avg60},
+	}
+	pressureThreshold := false
+	for _, p := range pressureThresholds {
+		pressureThreshold = pressureThreshold || p.threshold > 0
+	}
 	callbackURL := cfg.Server.UrlCallback
 	metricsToken := cfg.Server.Token
 
@@ -197,10 +329,12 @@ func CheckThresholds(metrics database.ServerMetric) error {
 	// log.Printf("Callback URL: %s", callbackURL)
 	// log.Printf("Metrics token: %s", metricsToken)
 
-	if cpuThreshold == 0 && memThreshold == 0 {
+	if cpuThreshold == 0 && memThreshold == 0 && diskThreshold == 0 && inodesThreshold == 0 && swapThreshold == 0 && !pressureThreshold {
 		return nil
 	}
 
+	snapshot := database.NewProcessSnapshot(metrics.Timestamp, metrics.Processes)
+
 	if cpuThreshold > 0 && metrics.CPU > cpuThreshold {
 		alert := AlertPayload{
 			ServerType: cfg.Server.ServerType,
@@ -210,6 +344,7 @@ func CheckThresholds(metrics database.ServerMetric) error {
 			Message:    fmt.Sprintf("CPU usage (%.2f%%) exceeded threshold (%.2f%%)", metrics.CPU, cpuThreshold),
 			Timestamp:  metrics.Timestamp,
 			Token:      metricsToken,
+			Processes:  snapshot.CPU,
 		}
 		if err := sendAlert(callbackURL, alert); err != nil {
 			return fmt.Errorf("failed to send CPU alert: %v", err)
@@ -225,12 +360,80 @@ func CheckThresholds(metrics database.ServerMetric) error {
 			Message:    fmt.Sprintf("Memory usage (%.2f%%) exceeded threshold (%.2f%%)", metrics.MemUsed, memThreshold),
 			Timestamp:  metrics.Timestamp,
 			Token:      metricsToken,
+			Processes:  snapshot.Memory,
 		}
 		if err := sendAlert(callbackURL, alert); err != nil {
 			return fmt.Errorf("failed to send memory alert: %v", err)
 		}
 	}
 
+	// Hosts without swap report 0% and never alert
+	if swapThreshold > 0 && metrics.SwapUsedPercent > swapThreshold {
+		alert := AlertPayload{
+			ServerType: cfg.Server.ServerType,
+			Type:       "Swap",
+			Value:      metrics.SwapUsedPercent,
+			Threshold:  swapThreshold,
+			Message:    fmt.Sprintf("Swap usage (%.2f%%) exceeded threshold (%.2f%%)", metrics.SwapUsedPercent, swapThreshold),
+			Timestamp:  metrics.Timestamp,
+			Token:      metricsToken,
+		}
+		if err := sendAlert(callbackURL, alert); err != nil {
+			return fmt.Errorf("failed to send swap alert: %v", err)
+		}
+	}
+
+	for _, p := range pressureThresholds {
+		if p.threshold > 0 && p.value > p.threshold {
+			alert := AlertPayload{
+				ServerType: cfg.Server.ServerType,
+				Type:       p.resource + "Pressure",
+				Value:      p.value,
+				Threshold:  p.threshold,
+				Message:    fmt.Sprintf("%s pressure (%.2f%% stalled over 60s) exceeded threshold (%.2f%%)", p.resource, p.value, p.threshold),
+				Timestamp:  metrics.Timestamp,
+				Token:      metricsToken,
+			}
+			if err := sendAlert(callbackURL, alert); err != nil {
+				return fmt.Errorf("failed to send %s pressure alert: %v", p.resource, err)
+			}
+		}
+	}
+
+	for _, d := range metrics.Disks {
+		if diskThreshold > 0 && d.UsedPercent > diskThreshold {
+			alert := AlertPayload{
+				ServerType: cfg.Server.ServerType,
+				Type:       "Disk",
+				Value:      d.UsedPercent,
+				Threshold:  diskThreshold,
+				Message:    fmt.Sprintf("Disk usage of %s (%.2f%%) exceeded threshold (%.2f%%)", d.Mountpoint, d.UsedPercent, diskThreshold),
+				Timestamp:  metrics.Timestamp,
+				Token:      metricsToken,
+				Mountpoint: d.Mountpoint,
+			}
+			if err := sendAlert(callbackURL, alert); err != nil {
+				return fmt.Errorf("failed to send disk alert: %v", err)
+			}
+		}
+
+		if inodesThreshold > 0 && d.InodesUsedPercent > inodesThreshold {
+			alert := AlertPayload{
+				ServerType: cfg.Server.ServerType,
+				Type:       "Inodes",
+				Value:      d.InodesUsedPercent,
+				Threshold:  inodesThreshold,
+				Message:    fmt.Sprintf("Inode usage of %s (%.2f%%) exceeded threshold (%.2f%%)", d.Mountpoint, d.InodesUsedPercent, inodesThreshold),
+				Timestamp:  metrics.Timestamp,
+				Token:      metricsToken,
+				Mountpoint: d.Mountpoint,
+			}
+			if err := sendAlert(callbackURL, alert); err != nil {
+				return fmt.Errorf("failed to send inodes alert: %v", err)
+			}
+		}
+	}
+
 	return nil
 }
 
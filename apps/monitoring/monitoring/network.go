@@ -0,0 +1,97 @@
+package monitoring
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/shirou/gopsutil/v3/net"
+
+	"github.com/mauriciogm/dokploy/apps/monitoring/config"
+	"github.com/mauriciogm/dokploy/apps/monitoring/database"
+)
+
+// getInterfaceMetrics returns the counters of the interfaces selected by
+// server.network. Without an include list only physical NICs are selected,
+// or every interface but loopback when none is found (e.g. inside a VM
+// without a device entry).
+func getInterfaceMetrics(ctx context.Context, timestamp string) []database.InterfaceMetric {
+	cfg := config.GetMetricsConfig()
+
+	// <proc>/net/dev is the network namespace of the reader, which is the
+	// agent container; the one of PID 1 is the host namespace
+	counters, err := net.IOCountersByFileWithContext(ctx, true, filepath.Join(cfg.HostPath(cfg.Server.ProcRoot), "1", "net", "dev"))
+	if err != nil {
+		counters, err = net.IOCountersWithContext(ctx, true)
+	}
+	if err != nil {
+		return nil
+	}
+
+	selected := selectHostInterfaces(counters, cfg.Server.Network.Include, cfg.Server.Network.Exclude, cfg.HostPath("/sys/class/net"))
+
+	metrics := make([]database.InterfaceMetric, 0, len(selected))
+	for _, c := range selected {
+		metrics = append(metrics, database.InterfaceMetric{
+			Timestamp:   timestamp,
+			Interface:   c.Name,
+			BytesRecv:   c.BytesRecv,
+			BytesSent:   c.BytesSent,
+			PacketsRecv: c.PacketsRecv,
+			PacketsSent: c.PacketsSent,
+			ErrIn:       c.Errin,
+			ErrOut:      c.Errout,
+			DropIn:      c.Dropin,
+			DropOut:     c.Dropout,
+		})
+	}
+	return metrics
+}
+
+// selectHostInterfaces applies server.network, defaulting to the physical
+// NICs found under sysClassNet and then to every interface but loopback
+func selectHostInterfaces(counters []net.IOCountersStat, include, exclude []string, sysClassNet string) []net.IOCountersStat {
+	isPhysical := func(name string) bool { return isPhysicalInterface(sysClassNet, name) }
+
+	selected := selectInterfaces(counters, include, exclude, isPhysical)
+	if len(selected) == 0 && len(include) == 0 {
+		selected = selectInterfaces(counters, nil, append([]string{"lo"}, exclude...), func(string) bool { return true })
+	}
+	return selected
+}
+
+// selectInterfaces applies the include/exclude glob patterns. An empty
+// include list falls back to the default predicate.
+func selectInterfaces(counters []net.IOCountersStat, include, exclude []string, byDefault func(name string) bool) []net.IOCountersStat {
+	var selected []net.IOCountersStat
+	for _, c := range counters {
+		if matchesAny(exclude, c.Name) {
+			continue
+		}
+		if len(include) > 0 && !matchesAny(include, c.Name) {
+			continue
+		}
+		if len(include) == 0 && !byDefault(c.Name) {
+			continue
+		}
+		selected = append(selected, c)
+	}
+	return selected
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// isPhysicalInterface reports whether the interface is backed by a device;
+// virtual ones (loopback, bridges, veth, tunnels) have no device link
+func isPhysicalInterface(sysClassNet, name string) bool {
+	_, err := os.Stat(filepath.Join(sysClassNet, name, "device"))
+	return err == nil
+}
@@ -0,0 +1,80 @@
+package monitoring
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+// newSysClassNet creates a /sys/class/net with a device link for each of
+// the physical interfaces and none for the virtual ones
+func newSysClassNet(t *testing.T, physical, virtual []string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	for _, name := range physical {
+		if err := os.MkdirAll(filepath.Join(root, name, "device"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range virtual {
+		if err := os.MkdirAll(filepath.Join(root, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func interfaceCounters(names ...string) []net.IOCountersStat {
+	counters := make([]net.IOCountersStat, len(names))
+	for i, name := range names {
+		counters[i] = net.IOCountersStat{Name: name}
+	}
+	return counters
+}
+
+func interfaceNames(counters []net.IOCountersStat) []string {
+	var names []string
+	for _, c := range counters {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func TestSelectHostInterfaces(t *testing.T) {
+	host := newSysClassNet(t, []string{"eth0", "ens3"}, []string{"lo", "docker0", "docker_gwbridge", "veth1a2b"})
+	counters := interfaceCounters("lo", "eth0", "docker0", "docker_gwbridge", "veth1a2b", "ens3")
+
+	// A VM whose interfaces have no device entry
+	vm := newSysClassNet(t, nil, []string{"lo", "eth0", "docker0"})
+
+	tests := []struct {
+		name        string
+		sysClassNet string
+		include     []string
+		exclude     []string
+		want        []string
+	}{
+		{name: "physical NICs", sysClassNet: host, want: []string{"eth0", "ens3"}},
+		{name: "excluded NIC", sysClassNet: host, exclude: []string{"ens*"}, want: []string{"eth0"}},
+		{name: "no physical NIC", sysClassNet: vm, want: []string{"eth0", "docker0", "docker_gwbridge", "veth1a2b", "ens3"}},
+		{name: "no physical NIC with exclude", sysClassNet: vm, exclude: []string{"docker*", "veth*"}, want: []string{"eth0", "ens3"}},
+		{name: "include list", sysClassNet: host, include: []string{"docker_gwbridge", "eth*"}, want: []string{"eth0", "docker_gwbridge"}},
+		{name: "exclude wins over include", sysClassNet: host, include: []string{"docker*"}, exclude: []string{"docker0"}, want: []string{"docker_gwbridge"}},
+		// An include list matching nothing does not fall back
+		{name: "include list without match", sysClassNet: host, include: []string{"wlan*"}},
+		{name: "include loopback", sysClassNet: host, include: []string{"lo"}, want: []string{"lo"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := interfaceNames(selectHostInterfaces(counters, tt.include, tt.exclude, tt.sysClassNet))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package monitoring
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/mauriciogm/dokploy/apps/monitoring/database"
+)
+
+// getPressure reads the host PSI files under <procRoot>/pressure. Resources
+// that cannot be read, such as on kernels built without PSI, stay at zero.
+func getPressure(procRoot string) database.PressureMetric {
+	var pressure database.PressureMetric
+	for name, resource := range pressure.Resources() {
+		content, err := os.ReadFile(filepath.Join(procRoot, "pressure", name))
+		if err != nil {
+			continue
+		}
+		if parsed, err := database.ParsePressure(string(content)); err == nil {
+			*resource = parsed
+		}
+	}
+	return pressure
+}
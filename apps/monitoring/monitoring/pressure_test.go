@@ -0,0 +1,36 @@
+package monitoring
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mauriciogm/dokploy/apps/monitoring/database"
+)
+
+func TestGetPressure(t *testing.T) {
+	got := getPressure("testdata/proc")
+
+	want := database.PressureMetric{
+		// The fixture has no full line for cpu, like kernels before 5.13
+		CPU: database.PressureResource{
+			Some: database.PressureStall{Avg10: 0.5, Avg60: 0.4, Avg300: 0.3, Total: 4000},
+		},
+		Memory: database.PressureResource{
+			Some: database.PressureStall{Total: 10},
+			Full: database.PressureStall{Total: 5},
+		},
+		IO: database.PressureResource{
+			Some: database.PressureStall{Avg10: 1.25, Avg60: 1, Avg300: 0.75, Total: 7000},
+			Full: database.PressureStall{Avg10: 1, Avg60: 0.8, Avg300: 0.6, Total: 6000},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestGetPressureWithoutPSI(t *testing.T) {
+	if got := getPressure("testdata/missing"); got != (database.PressureMetric{}) {
+		t.Errorf("got %+v, want zero values", got)
+	}
+}
@@ -0,0 +1,199 @@
+package monitoring
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/process"
+
+	"github.com/mauriciogm/dokploy/apps/monitoring/config"
+	"github.com/mauriciogm/dokploy/apps/monitoring/database"
+)
+
+const maxCmdlineLength = 256
+
+// Docker cgroups end with the full container ID, with either cgroup driver
+var containerIDPattern = regexp.MustCompile(`([0-9a-f]{64})(?:\.scope)?$`)
+
+// processSampler keeps the CPU time of every process at the previous
+// snapshot, to compute their usage between two snapshots
+type processSampler struct {
+	previous map[int32]processCPU
+	at       time.Time
+}
+
+type processCPU struct {
+	createTime int64 // milliseconds, to tell apart a reused pid
+	seconds    float64
+}
+
+type processSample struct {
+	proc   *process.Process
+	cpu    float64
+	rss    uint64
+	memory float64
+}
+
+// snapshot returns the top server.processes.count processes by CPU and by
+// RSS, or nil when the count is 0
+func (ps *processSampler) snapshot(timestamp string) []database.ProcessMetric {
+	cfg := config.GetMetricsConfig()
+	count := cfg.Server.Processes.Count
+	if count == 0 {
+		return nil
+	}
+
+	ctx := hostContext(cfg)
+	procs, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		return nil
+	}
+
+	var memTotal uint64
+	if v, err := mem.VirtualMemoryWithContext(ctx); err == nil {
+		memTotal = v.Total
+	}
+
+	now := time.Now()
+	current := make(map[int32]processCPU, len(procs))
+	samples := make([]processSample, 0, len(procs))
+	for _, p := range procs {
+		times, err := p.TimesWithContext(ctx)
+		if err != nil {
+			continue
+		}
+		createTime, _ := p.CreateTimeWithContext(ctx)
+		cpuTime := processCPU{createTime: createTime, seconds: times.User + times.System}
+		current[p.Pid] = cpuTime
+
+		// Processes started since the previous snapshot report their
+		// average usage since they started
+		sample := processSample{proc: p}
+		if prev, ok := ps.previous[p.Pid]; ok && prev.createTime == createTime {
+			if elapsed := now.Sub(ps.at).Seconds(); elapsed > 0 && cpuTime.seconds >= prev.seconds {
+				sample.cpu = (cpuTime.seconds - prev.seconds) / elapsed * 100
+			}
+		} else if elapsed := now.Sub(time.UnixMilli(createTime)).Seconds(); createTime > 0 && elapsed > 0 {
+			sample.cpu = cpuTime.seconds / elapsed * 100
+		}
+
+		if info, err := p.MemoryInfoWithContext(ctx); err == nil {
+			sample.rss = info.RSS
+			if memTotal > 0 {
+				sample.memory = float64(info.RSS) / float64(memTotal) * 100
+			}
+		}
+		samples = append(samples, sample)
+	}
+	ps.previous = current
+	ps.at = now
+
+	users := readUsers(cfg.HostPath("/etc/passwd"))
+	ranks := make(map[int32]*database.ProcessMetric)
+	var processes []*database.ProcessMetric
+	rank := func(less func(a, b processSample) bool, set func(m *database.ProcessMetric, rank int)) {
+		sort.SliceStable(samples, func(i, j int) bool { return less(samples[i], samples[j]) })
+		for i := 0; i < count && i < len(samples); i++ {
+			m, ok := ranks[samples[i].proc.Pid]
+			if !ok {
+				m = describeProcess(ctx, cfg, users, samples[i], timestamp)
+				ranks[samples[i].proc.Pid] = m
+				processes = append(processes, m)
+			}
+			set(m, i+1)
+		}
+	}
+	rank(func(a, b processSample) bool { return a.cpu > b.cpu }, func(m *database.ProcessMetric, rank int) { m.CPURank = rank })
+	rank(func(a, b processSample) bool { return a.rss > b.rss }, func(m *database.ProcessMetric, rank int) { m.MemoryRank = rank })
+
+	metrics := make([]database.ProcessMetric, len(processes))
+	for i, m := range processes {
+		metrics[i] = *m
+	}
+	return metrics
+}
+
+// describeProcess reads the details of a process that made it into a top, which
+// are too expensive to read for every process
+func describeProcess(ctx context.Context, cfg *config.Config, users map[string]string, sample processSample, timestamp string) *database.ProcessMetric {
+	p := sample.proc
+	name, _ := p.NameWithContext(ctx)
+	cmdline, _ := p.CmdlineWithContext(ctx)
+	cmdline = truncateUTF8(cmdline, maxCmdlineLength)
+
+	var user string
+	if uids, err := p.UidsWithContext(ctx); err == nil && len(uids) > 0 {
+		user = strconv.Itoa(int(uids[0]))
+		if name, ok := users[user]; ok {
+			user = name
+		}
+	}
+
+	return &database.ProcessMetric{
+		Timestamp:   timestamp,
+		PID:         p.Pid,
+		Name:        name,
+		Cmdline:     cmdline,
+		User:        user,
+		ContainerID: processContainerID(filepath.Join(cfg.HostPath(cfg.Server.ProcRoot), strconv.Itoa(int(p.Pid)), "cgroup")),
+		CPU:         sample.cpu,
+		RSS:         sample.rss,
+		Memory:      sample.memory,
+	}
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// readUsers maps uids to names with the passwd file of the host, since the
+// one of the agent container does not know the host users. Unknown uids are
+// reported as a number.
+func readUsers(passwd string) map[string]string {
+	users := make(map[string]string)
+	file, err := os.Open(passwd)
+	if err != nil {
+		return users
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) > 2 {
+			users[fields[2]] = fields[0]
+		}
+	}
+	return users
+}
+
+// processContainerID returns the short ID of the container a process runs
+// in, from its /proc/<pid>/cgroup file, or "" for host processes
+func processContainerID(cgroupFile string) string {
+	content, err := os.ReadFile(cgroupFile)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if match := containerIDPattern.FindStringSubmatch(strings.TrimSpace(line)); match != nil {
+			return match[1][:12]
+		}
+	}
+	return ""
+}
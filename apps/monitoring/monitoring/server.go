@@ -0,0 +1,102 @@
+package monitoring
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mauriciogm/dokploy/apps/monitoring/config"
+	"github.com/mauriciogm/dokploy/apps/monitoring/database"
+)
+
+// ServerMonitor periodically stores the host metrics and checks thresholds
+type ServerMonitor struct {
+	db       *database.DB
+	mu       sync.Mutex
+	stopChan chan struct{}
+	done     chan struct{} // closed when the collection goroutine exits
+
+	// previous sample, to compute the network and disk I/O rates
+	previous *database.ServerMetric
+
+	processes processSampler
+}
+
+func NewServerMonitor(db *database.DB) *ServerMonitor {
+	return &ServerMonitor{db: db}
+}
+
+func (sm *ServerMonitor) Start() {
+	refreshRate := config.GetMetricsConfig().Server.RefreshRate
+	duration := time.Duration(refreshRate) * time.Second
+
+	stopChan := make(chan struct{})
+	done := make(chan struct{})
+	sm.mu.Lock()
+	sm.stopChan = stopChan
+	sm.done = done
+	sm.mu.Unlock()
+
+	log.Printf("Refreshing server metrics every %v", duration)
+	ticker := time.NewTicker(duration)
+
+	go func() {
+		defer close(done)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				metrics := GetServerMetrics()
+				metrics.SetRates(sm.previous)
+				metrics.Processes = sm.processes.snapshot(metrics.Timestamp)
+				sm.previous = &metrics
+
+				if err := sm.db.SaveMetric(metrics); err != nil {
+					log.Printf("Error saving metrics: %v", err)
+				}
+				if err := sm.db.SaveInterfaceMetrics(metrics.Interfaces); err != nil {
+					log.Printf("Error saving network interface metrics: %v", err)
+				}
+				if err := sm.db.SaveDiskMetrics(metrics.Disks); err != nil {
+					log.Printf("Error saving disk metrics: %v", err)
+				}
+				if err := sm.db.SaveDiskIOMetrics(metrics.DiskIO); err != nil {
+					log.Printf("Error saving disk I/O metrics: %v", err)
+				}
+				if err := sm.db.SaveCPUCoreMetrics(metrics.Cores); err != nil {
+					log.Printf("Error saving CPU core metrics: %v", err)
+				}
+				if err := sm.db.SaveProcessMetrics(metrics.Processes); err != nil {
+					log.Printf("Error saving process snapshot: %v", err)
+				}
+
+				if err := CheckThresholds(metrics); err != nil {
+					log.Printf("Error checking thresholds: %v", err)
+				}
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop waits for a collection in progress, so a restarted monitor never
+// runs next to the previous one
+func (sm *ServerMonitor) Stop() {
+	sm.mu.Lock()
+	stopChan, done := sm.stopChan, sm.done
+	sm.stopChan, sm.done = nil, nil
+	sm.mu.Unlock()
+
+	if stopChan != nil {
+		close(stopChan)
+		<-done
+	}
+}
+
+// Restart picks up a new refresh rate
+func (sm *ServerMonitor) Restart() {
+	sm.Stop()
+	sm.Start()
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/mauriciogm/dokploy/apps/monitoring/database"
+)
+
+// parseTimeRange reads the from/to or last query parameters. from and to
+// accept RFC3339 or unix milliseconds; a missing to means now. last is a
+// duration relative to now such as 30m, 6h or 7d. hasRange is false when
+// none of them is set so the caller can fall back to limit.
+func parseTimeRange(c *fiber.Ctx) (from, to time.Time, hasRange bool, err error) {
+	last := c.Query("last")
+	fromParam := c.Query("from")
+	toParam := c.Query("to")
+
+	if last == "" && fromParam == "" && toParam == "" {
+		return time.Time{}, time.Time{}, false, nil
+	}
+
+	now := time.Now()
+
+	if last != "" {
+		if fromParam != "" || toParam != "" {
+			return from, to, false, fmt.Errorf("last cannot be combined with from/to")
+		}
+		d, err := parseRelativeDuration(last)
+		if err != nil {
+			return from, to, false, fmt.Errorf("invalid last %q: %v", last, err)
+		}
+		return now.Add(-d), now, true, nil
+	}
+
+	to = now
+	if toParam != "" {
+		if to, err = parseTimeParam(toParam); err != nil {
+			return from, to, false, fmt.Errorf("invalid to %q: %v", toParam, err)
+		}
+	}
+
+	if fromParam != "" {
+		if from, err = parseTimeParam(fromParam); err != nil {
+			return from, to, false, fmt.Errorf("invalid from %q: %v", fromParam, err)
+		}
+	} else {
+		from = time.Unix(0, 0)
+	}
+
+	if from.After(to) {
+		return from, to, false, fmt.Errorf("from must be before to")
+	}
+
+	return from, to, true, nil
+}
+
+func parseTimeParam(value string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// maxRelativeDays is the longest day count a time.Duration can hold
+const maxRelativeDays = math.MaxInt64 / int64(24*time.Hour)
+
+// parseRelativeDuration extends time.ParseDuration with a day unit
+func parseRelativeDuration(value string) (time.Duration, error) {
+	var d time.Duration
+	if days, found := strings.CutSuffix(value, "d"); found {
+		n, err := strconv.ParseInt(days, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("expected a number of days")
+		}
+		if n > maxRelativeDays {
+			return 0, fmt.Errorf("must be at most %dd", maxRelativeDays)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, err
+		}
+		d = parsed
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return d, nil
+}
+
+// parseBucketQuery reads the step and agg query parameters. ok is false when
+// no step is given and the raw samples should be returned.
+func parseBucketQuery(c *fiber.Ctx, from, to time.Time) (q database.BucketQuery, ok bool, err error) {
+	stepParam := c.Query("step")
+	aggParam := c.Query("agg", "avg")
+	if stepParam == "" {
+		return q, false, nil
+	}
+
+	step, err := parseRelativeDuration(stepParam)
+	if err != nil {
+		return q, false, fmt.Errorf("invalid step %q: %v", stepParam, err)
+	}
+	if step < time.Second {
+		return q, false, fmt.Errorf("invalid step %q: must be at least 1s", stepParam)
+	}
+	if _, known := database.Aggregations[aggParam]; !known {
+		return q, false, fmt.Errorf("invalid agg %q: use avg, min, max, p50, p95, p99 or last", aggParam)
+	}
+
+	return database.BucketQuery{
+		From:        from,
+		To:          to,
+		Step:        step,
+		Aggregation: aggParam,
+	}, true, nil
+}
+
+// parseNetworkMode reads the network query parameter: "rate" (default)
+// returns bytes per second, "raw" the cumulative counters
+func parseNetworkMode(c *fiber.Ctx) (raw bool, err error) {
+	switch mode := c.Query("network", "rate"); mode {
+	case "rate":
+		return false, nil
+	case "raw":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid network mode %q: expected rate or raw", mode)
+	}
+}
+
+// parseUnits reads the units query parameter: "bytes" (default) returns sizes
+// as stored, "human" scales them to KB, MB... for display
+func parseUnits(c *fiber.Ctx) (human bool, err error) {
+	switch units := c.Query("units", "bytes"); units {
+	case "bytes":
+		return false, nil
+	case "human":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid units %q: expected bytes or human", units)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type timeRange struct {
+	from, to time.Time
+	hasRange bool
+	err      error
+}
+
+// queryTimeRange runs parseTimeRange on a request with the given query string
+func queryTimeRange(t *testing.T, query string) timeRange {
+	t.Helper()
+
+	var result timeRange
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		result.from, result.to, result.hasRange, result.err = parseTimeRange(c)
+		return nil
+	})
+	if _, err := app.Test(httptest.NewRequest("GET", "/?"+query, nil)); err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	return result
+}
+
+func TestParseTimeRange(t *testing.T) {
+	from := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	to := from.Add(6 * time.Hour)
+
+	tests := []struct {
+		name     string
+		query    string
+		from, to time.Time
+	}{
+		{"rfc3339", "from=2024-01-02T03:04:05Z&to=2024-01-02T09:04:05Z", from, to},
+		{"rfc3339 with offset", "from=2024-01-02T05:04:05%2B02:00&to=2024-01-02T09:04:05Z", from, to},
+		{"unix ms", "from=1704164645000&to=1704186245000", from, to},
+		{"mixed", "from=1704164645000&to=2024-01-02T09:04:05Z", from, to},
+		{"no from", "to=2024-01-02T09:04:05Z", time.Unix(0, 0), to},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := queryTimeRange(t, tt.query)
+			if got.err != nil {
+				t.Fatalf("parseTimeRange: %v", got.err)
+			}
+			if !got.hasRange || !got.from.Equal(tt.from) || !got.to.Equal(tt.to) {
+				t.Errorf("got %v to %v (%v), want %v to %v", got.from, got.to, got.hasRange, tt.from, tt.to)
+			}
+		})
+	}
+}
+
+func TestParseTimeRangeRelative(t *testing.T) {
+	before := time.Now()
+	got := queryTimeRange(t, "last=6h")
+	if got.err != nil || !got.hasRange {
+		t.Fatalf("got %v (%v)", got.err, got.hasRange)
+	}
+	if d := got.to.Sub(got.from); d != 6*time.Hour {
+		t.Errorf("got a range of %v, want 6h", d)
+	}
+	if got.to.Before(before) || time.Since(got.to) > time.Minute {
+		t.Errorf("got to %v, want now", got.to)
+	}
+
+	// A missing to means now
+	got = queryTimeRange(t, "from=2024-01-02T03:04:05Z")
+	if got.err != nil || got.to.Before(before) {
+		t.Errorf("got to %v (%v), want now", got.to, got.err)
+	}
+}
+
+func TestParseTimeRangeNone(t *testing.T) {
+	got := queryTimeRange(t, "limit=50")
+	if got.err != nil || got.hasRange {
+		t.Errorf("got %v (%v), want no range", got.err, got.hasRange)
+	}
+}
+
+func TestParseTimeRangeErrors(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantErr string
+	}{
+		{"from=2024-01-02T09:04:05Z&to=2024-01-02T03:04:05Z", "from must be before to"},
+		{"last=6h&from=2024-01-02T03:04:05Z", "last cannot be combined with from/to"},
+		{"last=6h&to=1704186245000", "last cannot be combined with from/to"},
+		{"from=yesterday", `invalid from "yesterday"`},
+		{"to=2024-01-02", `invalid to "2024-01-02"`},
+		{"last=soon", `invalid last "soon"`},
+		{"last=-1h", "must be positive"},
+		{"last=0d", "must be positive"},
+		{"last=100000000d", "must be at most"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got := queryTimeRange(t, tt.query)
+			if got.err == nil || !strings.Contains(got.err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", got.err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseRelativeDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "30m", want: 30 * time.Minute},
+		{value: "1h30m", want: 90 * time.Minute},
+		{value: "7d", want: 7 * 24 * time.Hour},
+		{value: "106751d", want: 106751 * 24 * time.Hour},
+		{value: "106752d", wantErr: true},
+		// Would wrap around to a positive duration without the bound
+		{value: "213504d", wantErr: true},
+		{value: "9223372036854775807d", wantErr: true},
+		{value: "99999999999999999999h", wantErr: true},
+		{value: "1.5d", wantErr: true},
+		{value: "d", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseRelativeDuration(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("got %v (%v), want %v", got, err, tt.want)
+			}
+		})
+	}
+}
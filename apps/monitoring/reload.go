@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/mauriciogm/dokploy/apps/monitoring/config"
+	"github.com/mauriciogm/dokploy/apps/monitoring/containers"
+	"github.com/mauriciogm/dokploy/apps/monitoring/database"
+	"github.com/mauriciogm/dokploy/apps/monitoring/monitoring"
+)
+
+const configWatchInterval = 5 * time.Second
+
+// configReloader re-reads the configuration on SIGHUP or when the config
+// file changes and restarts only the parts affected by the changes
+type configReloader struct {
+	db               *database.DB
+	serverMonitor    *monitoring.ServerMonitor
+	containerMonitor *containers.ContainerMonitor
+	diskUsageMonitor *containers.DiskUsageMonitor
+
+	mu          sync.Mutex
+	cleanupCron *cron.Cron
+
+	// serializes configuration changes, from PATCH /config or a reload, so
+	// one never applies settings the other already replaced
+	updateMu sync.Mutex
+}
+
+// invalidPatchError is returned for request bodies that cannot be merged
+type invalidPatchError struct {
+	err error
+}
+
+func (e invalidPatchError) Error() string {
+	return "invalid configuration patch: " + e.err.Error()
+}
+
+// loadRuntimeSettings applies the settings stored through the API on
+// startup. Stored settings that no longer validate are ignored.
+func loadRuntimeSettings(db *database.DB) {
+	stored, err := db.GetRuntimeConfig()
+	if err != nil {
+		log.Printf("Error reading stored runtime configuration: %v", err)
+		return
+	}
+	if stored == "" {
+		return
+	}
+
+	settings := &config.RuntimeSettings{}
+	if err := settings.Merge([]byte(stored)); err != nil {
+		log.Printf("Ignoring stored runtime configuration: %v", err)
+		return
+	}
+
+	cfg, err := config.LoadMetricsConfigWith(settings)
+	if err != nil {
+		log.Printf("Ignoring stored runtime configuration: %v", err)
+		return
+	}
+
+	config.SetRuntimeOverrides(settings)
+	config.SetMetricsConfig(cfg)
+	log.Printf("Applied runtime configuration stored in the database")
+}
+
+// updateRuntimeSettings validates a PATCH /config body, persists it and
+// applies it to the running monitors
+func (r *configReloader) updateRuntimeSettings(patch []byte) (*config.Config, error) {
+	r.updateMu.Lock()
+	defer r.updateMu.Unlock()
+
+	settings := config.RuntimeOverrides()
+	if err := settings.Merge(patch); err != nil {
+		return nil, invalidPatchError{err}
+	}
+
+	current, err := config.LoadMetricsConfigWith(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	settingsJSON, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.db.SaveRuntimeConfig(string(settingsJSON)); err != nil {
+		return nil, fmt.Errorf("error saving runtime configuration: %v", err)
+	}
+
+	config.SetRuntimeOverrides(settings)
+	previous := config.SetMetricsConfig(current)
+
+	changes := config.Diff(previous, current)
+	log.Printf("Configuration updated through the API with %d change(s):", len(changes))
+	for _, change := range changes {
+		log.Printf("  %s", change)
+	}
+
+	r.apply(previous, current)
+	return current, nil
+}
+
+func (r *configReloader) watch() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			log.Printf("Received SIGHUP, reloading configuration")
+			r.reload()
+		}
+	}()
+
+	if path := config.ConfigPath(); path != "" {
+		go config.WatchConfigFile(path, configWatchInterval, r.reload, nil)
+	}
+}
+
+func (r *configReloader) reload() {
+	r.updateMu.Lock()
+	defer r.updateMu.Unlock()
+
+	previous, current, err := config.ReloadMetricsConfig()
+	if err != nil {
+		log.Printf("Error reloading configuration, keeping the previous one: %v", err)
+		return
+	}
+
+	changes := config.Diff(previous, current)
+	if len(changes) == 0 {
+		log.Printf("Configuration reloaded, nothing changed")
+		return
+	}
+
+	log.Printf("Configuration reloaded with %d change(s):", len(changes))
+	for _, change := range changes {
+		log.Printf("  %s", change)
+	}
+
+	r.apply(previous, current)
+}
+
+// apply restarts the tickers and the cleanup job whose settings changed.
+// Thresholds, the token and the callback URL are read on every use and need
+// no restart.
+func (r *configReloader) apply(previous, current *config.Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if previous.Server.RefreshRate != current.Server.RefreshRate {
+		r.serverMonitor.Restart()
+	}
+
+	if previous.Containers.RefreshRate != current.Containers.RefreshRate ||
+		previous.Containers.DockerSocket != current.Containers.DockerSocket ||
+		previous.Containers.Backend != current.Containers.Backend ||
+		previous.Containers.CgroupRoot != current.Containers.CgroupRoot ||
+		previous.Server.ProcRoot != current.Server.ProcRoot ||
+		previous.Server.HostRoot != current.Server.HostRoot ||
+		!equalStrings(previous.Containers.Services.Include, current.Containers.Services.Include) ||
+		!equalStrings(previous.Containers.Services.Exclude, current.Containers.Services.Exclude) {
+		if err := r.containerMonitor.Reload(); err != nil {
+			log.Printf("Error reloading container monitor: %v", err)
+		}
+	}
+
+	if previous.Containers.DiskUsage.RefreshRate != current.Containers.DiskUsage.RefreshRate ||
+		previous.Containers.DockerSocket != current.Containers.DockerSocket {
+		r.diskUsageMonitor.Restart()
+	}
+
+	if previous.Server.RetentionDays != current.Server.RetentionDays ||
+		previous.Server.CronJob != current.Server.CronJob ||
+		previous.Server.Processes.RetentionHours != current.Server.Processes.RetentionHours {
+		cleanupCron, err := database.StartMetricsCleanup(r.db.DB, current.Server.RetentionDays, current.Server.CronJob, current.ProcessRetention())
+		if err != nil {
+			log.Printf("Error restarting metrics cleanup, keeping the previous schedule: %v", err)
+		} else {
+			r.cleanupCron.Stop()
+			r.cleanupCron = cleanupCron
+		}
+	}
+
+	if previous.Server.Port != current.Server.Port {
+		log.Printf("The server port only changes after a restart")
+	}
+}
+
+func (r *configReloader) stopCleanup() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cleanupCron.Stop()
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
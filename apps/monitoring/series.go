@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/mauriciogm/dokploy/apps/monitoring/database"
+)
+
+// seriesQueries are the reads of a table holding one row per collection and
+// key (network interface, mountpoint, ...)
+type seriesQueries[T any] struct {
+	lastN    func(keys []string, n int) ([]T, error)
+	all      func(keys []string) ([]T, error)
+	inRange  func(keys []string, from, to time.Time) ([]T, error)
+	bucketed func(keys []string, q database.BucketQuery) ([]T, error)
+}
+
+// seriesHandler serves a per-key table. keyParam is a comma separated list
+// of keys to return; limit, time ranges and bucketing work as on /metrics.
+func seriesHandler[T any](keyParam, errorMessage string, queries seriesQueries[T]) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		limit := c.Query("limit", "50")
+
+		var keys []string
+		if value := c.Query(keyParam); value != "" {
+			keys = strings.Split(value, ",")
+		}
+
+		from, to, hasRange, err := parseTimeRange(c)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		bucketQuery, bucketed, err := parseBucketQuery(c, from, to)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		var metrics []T
+		switch {
+		case bucketed:
+			metrics, err = queries.bucketed(keys, bucketQuery)
+		case hasRange:
+			metrics, err = queries.inRange(keys, from, to)
+		case limit == "all":
+			metrics, err = queries.all(keys)
+		default:
+			n, parseErr := strconv.Atoi(limit)
+			if parseErr != nil {
+				n = 50
+			}
+			metrics, err = queries.lastN(keys, n)
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": errorMessage,
+			})
+		}
+
+		return c.JSON(metrics)
+	}
+}